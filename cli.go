@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rabbitprincess/fastlz-go/codec"
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+)
+
+// errFailed is returned by runFastlz when some file failed. The failures
+// were already reported.
+var errFailed = errors.New("some files failed")
+
+type cli struct {
+	decompress, toStdout, keep, force, recursive, test, list bool
+
+	level  fastlzgo.Level
+	codec  codec.Codec
+	suffix string
+
+	stdin          io.Reader
+	stdout, stderr io.Writer
+
+	failed bool
+
+	/* list totals */
+	listed                   int
+	compressed, uncompressed int64
+}
+
+// runFastlz compresses or decompresses files in the stream format of
+// fastlzgo.Writer, like gzip.
+func runFastlz(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("fastlz", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fastlz [flags] [file ...]")
+		fmt.Fprintln(stderr, "       fastlz opfee [flags] [file]")
+		fmt.Fprintln(stderr, "Compresses or decompresses files in place, or stdin to stdout without files or with -.")
+		fs.PrintDefaults()
+	}
+	c := &cli{stdin: stdin, stdout: stdout, stderr: stderr}
+	fs.BoolVar(&c.decompress, "d", false, "decompress")
+	fs.BoolVar(&c.toStdout, "c", false, "write to stdout and keep the input files")
+	fs.BoolVar(&c.keep, "k", false, "keep the input files")
+	fs.BoolVar(&c.force, "f", false, "overwrite output files and write compressed data to a terminal")
+	fs.BoolVar(&c.recursive, "r", false, "compress or decompress the files in directories")
+	fs.BoolVar(&c.test, "t", false, "test the integrity of compressed files")
+	fs.BoolVar(&c.list, "l", false, "list the compressed and uncompressed sizes of compressed files")
+	level1 := fs.Bool("1", false, "compress with level 1")
+	level2 := fs.Bool("2", false, "compress with level 2")
+	backend := fs.String("backend", codec.Default().Name(), "FastLZ backend, one of "+strings.Join(codec.Backends(), ", "))
+	fs.StringVar(&c.suffix, "S", ".flz", "suffix of compressed files")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	switch {
+	case *level1 && *level2:
+		return errors.New("-1 and -2 can not be used together")
+	case *level1:
+		c.level = fastlzgo.Level1
+	case *level2:
+		c.level = fastlzgo.Level2
+	}
+	if c.suffix == "" {
+		return errors.New("empty suffix")
+	}
+	var err error
+	if c.codec, err = codec.New(*backend); err != nil {
+		return err
+	}
+
+	names := fs.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	for _, name := range names {
+		c.path(name)
+	}
+	if c.list && c.listed > 1 {
+		c.printList(c.compressed, c.uncompressed, "(totals)")
+	}
+
+	if c.failed {
+		return errFailed
+	}
+	return nil
+}
+
+func (c *cli) errorf(format string, args ...any) {
+	fmt.Fprintf(c.stderr, "fastlz: "+format+"\n", args...)
+	c.failed = true
+}
+
+// path processes a file name given on the command line.
+func (c *cli) path(name string) {
+	if name == "-" {
+		if err := c.stream(); err != nil {
+			c.errorf("stdin: %v", err)
+		}
+		return
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		c.errorf("%v", err)
+		return
+	}
+	if fi.IsDir() {
+		if !c.recursive {
+			c.errorf("%s is a directory -- ignored", name)
+			return
+		}
+		err := filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				c.errorf("%v", err)
+				return nil
+			}
+			if d.Type().IsRegular() {
+				c.path(path)
+			}
+			return nil
+		})
+		if err != nil {
+			c.errorf("%v", err)
+		}
+		return
+	}
+	if !fi.Mode().IsRegular() {
+		c.errorf("%s is not a regular file -- ignored", name)
+		return
+	}
+
+	if err := c.file(name, fi); err != nil {
+		c.errorf("%s: %v", name, err)
+	}
+}
+
+// stream processes stdin.
+func (c *cli) stream() error {
+	switch {
+	case c.list:
+		return c.listStream(c.stdin, -1, "stdout")
+	case c.test:
+		return c.decode(io.Discard, c.stdin)
+	case c.decompress:
+		return c.decode(c.stdout, c.stdin)
+	}
+
+	if f, ok := c.stdout.(*os.File); ok && !c.force {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			return errors.New("compressed data not written to a terminal, use -f to force compression")
+		}
+	}
+	return c.encode(c.stdout, c.stdin)
+}
+
+// file processes the regular file name.
+func (c *cli) file(name string, fi fs.FileInfo) error {
+	compressed := strings.HasSuffix(name, c.suffix)
+	switch {
+	case (c.decompress || c.test || c.list) && !compressed && !c.toStdout:
+		return errors.New("unknown suffix -- ignored")
+	case !c.decompress && !c.test && !c.list && compressed && !c.force:
+		return fmt.Errorf("already has %s suffix -- unchanged", c.suffix)
+	}
+
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	switch {
+	case c.list:
+		return c.listStream(in, fi.Size(), strings.TrimSuffix(name, c.suffix))
+	case c.test:
+		return c.decode(io.Discard, in)
+	case c.toStdout:
+		return c.process(c.stdout, in)
+	}
+
+	outName := name + c.suffix
+	if c.decompress {
+		outName = strings.TrimSuffix(name, c.suffix)
+	}
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !c.force {
+		flags |= os.O_EXCL
+	}
+	out, err := os.OpenFile(outName, flags, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	err = c.process(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(outName)
+		return err
+	}
+
+	if err := os.Chtimes(outName, fi.ModTime(), fi.ModTime()); err != nil {
+		return err
+	}
+	if !c.keep {
+		in.Close()
+		return os.Remove(name)
+	}
+	return nil
+}
+
+func (c *cli) process(w io.Writer, r io.Reader) error {
+	if c.decompress {
+		return c.decode(w, r)
+	}
+	return c.encode(w, r)
+}
+
+func (c *cli) encode(w io.Writer, r io.Reader) error {
+	opts := []fastlzgo.WriterOption{fastlzgo.WithLevel(c.level)}
+	if e, ok := c.codec.(codec.LevelIntoCompressor); ok {
+		opts = append(opts, fastlzgo.WithEncoder(e))
+	}
+	zw, err := fastlzgo.NewWriter(w, opts...)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func (c *cli) decode(w io.Writer, r io.Reader) error {
+	_, err := fastlzgo.NewReader(r, fastlzgo.WithDecoder(c.codec)).WriteTo(w)
+	return err
+}
+
+// listStream decompresses r to count its size. A negative size means the
+// compressed size is unknown and is counted too.
+func (c *cli) listStream(r io.Reader, size int64, name string) error {
+	cr := &countReader{r: r}
+	uncompressed, err := fastlzgo.NewReader(cr, fastlzgo.WithDecoder(c.codec)).WriteTo(io.Discard)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		size = cr.n
+	}
+
+	if c.listed == 0 {
+		fmt.Fprintf(c.stdout, "%19s %19s %6s %s\n", "compressed", "uncompressed", "ratio", "uncompressed_name")
+	}
+	c.printList(size, uncompressed, name)
+	c.listed++
+	c.compressed += size
+	c.uncompressed += uncompressed
+	return nil
+}
+
+func (c *cli) printList(compressed, uncompressed int64, name string) {
+	ratio := 0.0
+	if uncompressed > 0 {
+		ratio = 100 * (1 - float64(compressed)/float64(uncompressed))
+	}
+	fmt.Fprintf(c.stdout, "%19d %19d %5.1f%% %s\n", compressed, uncompressed, ratio, name)
+}
+
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,17 @@
+//go:build cgo && !purego
+
+package codec
+
+import "github.com/rabbitprincess/fastlz-go/fastlz"
+
+func init() {
+	backends[Cgo] = &backend{
+		name:           Cgo,
+		compressLevel:  fastlz.CompressLevel,
+		compressInto:   fastlz.CompressLevelInto,
+		decompress:     fastlz.Decompress,
+		decompressMax:  fastlz.DecompressLimit,
+		decompressInto: fastlz.DecompressInto,
+		compressBound:  fastlz.CompressBound,
+	}
+}
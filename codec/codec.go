@@ -0,0 +1,152 @@
+// Package codec exposes the cgo and pure Go FastLZ implementations behind a
+// single Codec interface.
+//
+// The cgo backend is compiled in when cgo is enabled, unless the purego build
+// tag is set. The pure Go backend is always available, so programs built with
+// CGO_ENABLED=0 keep working without code changes.
+package codec
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+)
+
+// Backend names accepted by New.
+const (
+	Cgo = "cgo"
+	Go  = "go"
+)
+
+// Level selects the FastLZ compression level.
+type Level = fastlzgo.Level
+
+const (
+	Auto   = fastlzgo.Auto
+	Level1 = fastlzgo.Level1
+	Level2 = fastlzgo.Level2
+)
+
+var (
+	ErrEmptyInput     = fastlzgo.ErrEmptyInput
+	ErrCorrupt        = fastlzgo.ErrCorrupt
+	ErrOutputTooSmall = fastlzgo.ErrOutputTooSmall
+	ErrUnknownLevel   = fastlzgo.ErrUnknownLevel
+	ErrTooLarge       = fastlzgo.ErrTooLarge
+)
+
+// Codec compresses and decompresses raw FastLZ blocks. Both backends produce
+// the same bytes and return the same errors.
+//
+// Codec does not grow, so implementations outside this package keep
+// compiling. Later additions are optional interfaces that the backends
+// implement; check for them with a type assertion.
+type Codec interface {
+	// Name returns the backend name, Cgo or Go.
+	Name() string
+	Compress(input []byte) ([]byte, error)
+	CompressLevel(input []byte, level Level) ([]byte, error)
+	Decompress(input []byte) ([]byte, error)
+	DecompressInto(dst, input []byte) (int, error)
+	CompressBound(n int) int
+}
+
+// LevelIntoCompressor compresses into a buffer of the caller. It is the
+// fastlzgo.Encoder used by the stream Writer.
+type LevelIntoCompressor interface {
+	CompressLevelInto(dst, src []byte, level Level) (int, error)
+}
+
+// LimitDecompressor decompresses with a bound on the output size.
+type LimitDecompressor interface {
+	// DecompressLimit fails with ErrTooLarge instead of decompressing to
+	// more than maxOutput bytes.
+	DecompressLimit(input []byte, maxOutput int) ([]byte, error)
+}
+
+type backend struct {
+	name           string
+	compressLevel  func(input []byte, level Level) ([]byte, error)
+	compressInto   func(dst, src []byte, level Level) (int, error)
+	decompress     func(input []byte) ([]byte, error)
+	decompressMax  func(input []byte, maxOutput int) ([]byte, error)
+	decompressInto func(dst, input []byte) (int, error)
+	compressBound  func(n int) int
+}
+
+var (
+	_ LevelIntoCompressor = (*backend)(nil)
+	_ LimitDecompressor   = (*backend)(nil)
+)
+
+func (b *backend) Name() string { return b.name }
+
+func (b *backend) Compress(input []byte) ([]byte, error) {
+	return b.compressLevel(input, Auto)
+}
+
+func (b *backend) CompressLevel(input []byte, level Level) ([]byte, error) {
+	return b.compressLevel(input, level)
+}
+
+func (b *backend) CompressLevelInto(dst, src []byte, level Level) (int, error) {
+	return b.compressInto(dst, src, level)
+}
+
+func (b *backend) Decompress(input []byte) ([]byte, error) {
+	return b.decompress(input)
+}
+
+func (b *backend) DecompressLimit(input []byte, maxOutput int) ([]byte, error) {
+	return b.decompressMax(input, maxOutput)
+}
+
+func (b *backend) DecompressInto(dst, input []byte) (int, error) {
+	return b.decompressInto(dst, input)
+}
+
+func (b *backend) CompressBound(n int) int {
+	return b.compressBound(n)
+}
+
+var backends = map[string]Codec{
+	Go: &backend{
+		name:           Go,
+		compressLevel:  fastlzgo.CompressLevel,
+		compressInto:   fastlzgo.CompressLevelInto,
+		decompress:     fastlzgo.Decompress,
+		decompressMax:  fastlzgo.DecompressLimit,
+		decompressInto: fastlzgo.DecompressInto,
+		compressBound:  fastlzgo.CompressBound,
+	},
+}
+
+// New returns the backend with the given name. It fails for Cgo when the
+// program was built without cgo or with the purego tag.
+func New(name string) (Codec, error) {
+	c, ok := backends[name]
+	if !ok {
+		return nil, fmt.Errorf("fastlz backend %q is not available", name)
+	}
+	return c, nil
+}
+
+// Default returns the cgo backend when it is compiled in and the pure Go one
+// otherwise.
+func Default() Codec {
+	if c, ok := backends[Cgo]; ok {
+		return c
+	}
+	return backends[Go]
+}
+
+// Backends returns the names of the backends compiled into the program.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,87 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCodec(t *testing.T) {
+	bt := bytes.Repeat([]byte("hello codec "), 10000)
+	var encs [][]byte
+	for _, name := range Backends() {
+		c, err := New(name)
+		require.NoError(t, err)
+		require.Equal(t, name, c.Name())
+
+		enc, err := c.Compress(bt)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(enc), c.CompressBound(len(bt)))
+		encs = append(encs, enc)
+
+		dec, err := c.Decompress(enc)
+		require.NoError(t, err)
+		require.Equal(t, bt, dec)
+
+		enc, err = c.CompressLevel(bt, Level2)
+		require.NoError(t, err)
+		dst := make([]byte, len(bt))
+		n, err := c.DecompressInto(dst, enc)
+		require.NoError(t, err)
+		require.Equal(t, bt, dst[:n])
+
+		ic, ok := c.(LevelIntoCompressor)
+		require.True(t, ok)
+		out := make([]byte, c.CompressBound(len(bt)))
+		size, err := ic.CompressLevelInto(out, bt, Level2)
+		require.NoError(t, err)
+		require.Equal(t, enc, out[:size])
+		_, err = ic.CompressLevelInto(out[:10], bt, Level2)
+		require.ErrorIs(t, err, ErrOutputTooSmall)
+
+		ld, ok := c.(LimitDecompressor)
+		require.True(t, ok)
+		dec, err = ld.DecompressLimit(enc, len(bt))
+		require.NoError(t, err)
+		require.Equal(t, bt, dec)
+		_, err = ld.DecompressLimit(enc, len(bt)-1)
+		require.ErrorIs(t, err, ErrTooLarge)
+
+		_, err = c.DecompressInto(dst[:10], enc)
+		require.ErrorIs(t, err, ErrOutputTooSmall)
+		_, err = c.CompressLevel(bt, Level(3))
+		require.ErrorIs(t, err, ErrUnknownLevel)
+	}
+
+	// every backend produces the same bytes
+	for _, enc := range encs {
+		require.Equal(t, encs[0], enc)
+	}
+
+	// and the same errors, also for a block the C decoder would read past
+	truncated := []byte{0x20, 'a', 0x20, 0x00}[:3]
+	for _, name := range Backends() {
+		c, err := New(name)
+		require.NoError(t, err)
+		_, err = c.DecompressInto(make([]byte, 16), truncated)
+		require.EqualError(t, err, "corrupt input: bad match at offset 2", name)
+		_, err = c.Decompress(truncated)
+		require.EqualError(t, err, "corrupt input: bad match at offset 2", name)
+	}
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("zstd")
+	require.Error(t, err)
+
+	c, err := New(Go)
+	require.NoError(t, err)
+	require.Equal(t, Go, c.Name())
+
+	if _, err := New(Cgo); err == nil {
+		require.Equal(t, Cgo, Default().Name())
+	} else {
+		require.Equal(t, Go, Default().Name())
+	}
+}
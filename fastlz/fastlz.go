@@ -5,24 +5,73 @@ package fastlz
 import "C"
 
 import (
+	"encoding/binary"
 	"errors"
+	"fmt"
+	"math"
 	"runtime"
+	"slices"
 	"unsafe"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+)
+
+// Level selects the FastLZ compression level. It is shared with fastlzgo so
+// that both backends accept the same values.
+type Level = fastlzgo.Level
+
+const (
+	Auto   = fastlzgo.Auto
+	Level1 = fastlzgo.Level1
+	Level2 = fastlzgo.Level2
 )
 
+// The errors are shared with fastlzgo, so errors.Is and errors.As work the
+// same with either backend.
+var (
+	ErrEmptyInput     = fastlzgo.ErrEmptyInput
+	ErrCorrupt        = fastlzgo.ErrCorrupt
+	ErrOutputTooSmall = fastlzgo.ErrOutputTooSmall
+	ErrUnknownLevel   = fastlzgo.ErrUnknownLevel
+	ErrTooLarge       = fastlzgo.ErrTooLarge
+)
+
+// CorruptError reports the token a decoder failed on.
+type CorruptError = fastlzgo.CorruptError
+
+// CompressBound returns the output buffer size needed to compress n bytes:
+// 5% larger than the input and not smaller than 66 bytes.
+func CompressBound(n int) int {
+	return fastlzgo.CompressBound(n)
+}
+
 // Compress compresses the input data using the FastLZ algorithm.
 // The version of FastLZ used is FastLZ level 1 with the implementation from
 // this commit: https://github.com/ariya/FastLZ/commit/344eb4025f9ae866ebf7a2ec48850f7113a97a42
 // Which is the same commit that Solady uses: https://github.com/Vectorized/solady/blob/main/src/utils/LibZip.sol#L19
 // Note the FastLZ compression ratio does vary between different versions of the library.
 func Compress(input []byte) ([]byte, error) {
+	return CompressLevel(input, Auto)
+}
+
+// CompressLevel compresses the input data with fastlz_compress_level.
+// Auto uses fastlz_compress, which keeps the behavior of Compress.
+func CompressLevel(input []byte, level Level) ([]byte, error) {
 	length := len(input)
 	if length == 0 {
-		return nil, errors.New("no input provided")
+		return nil, ErrEmptyInput
 	}
 
-	result := make([]byte, length*2)
-	size := C.fastlz_compress(unsafe.Pointer(&input[0]), C.int(length), unsafe.Pointer(&result[0]))
+	result := make([]byte, CompressBound(length))
+	var size C.int
+	switch level {
+	case Auto:
+		size = C.fastlz_compress(unsafe.Pointer(&input[0]), C.int(length), unsafe.Pointer(&result[0]))
+	case Level1, Level2:
+		size = C.fastlz_compress_level(C.int(level), unsafe.Pointer(&input[0]), C.int(length), unsafe.Pointer(&result[0]))
+	default:
+		return nil, ErrUnknownLevel
+	}
 	runtime.KeepAlive(input)
 
 	if size == 0 {
@@ -31,3 +80,269 @@ func Compress(input []byte) ([]byte, error) {
 
 	return result[:size], nil
 }
+
+// CompressedLen returns the length of Compress(input), without producing the
+// compressed data. FastLZ has no such function, so this runs the byte-exact
+// fastlzgo parse.
+func CompressedLen(input []byte) int {
+	return fastlzgo.CompressedLen(input)
+}
+
+// CompressedLenLevel returns the length of CompressLevel(input, level),
+// without producing the compressed data, with the fastlzgo parse.
+func CompressedLenLevel(input []byte, level Level) (int, error) {
+	return fastlzgo.CompressedLenLevel(input, level)
+}
+
+// AppendCompress appends the compressed src to dst and returns the extended
+// buffer, choosing the level like Compress. Nothing is appended for an empty
+// src. dst is only reallocated when its capacity is too small.
+func AppendCompress(dst, src []byte) []byte {
+	length := len(src)
+	if length == 0 {
+		return dst
+	}
+
+	n := len(dst)
+	bound := CompressBound(length)
+	dst = slices.Grow(dst, bound)
+	out := dst[n : n+bound]
+	size := C.fastlz_compress(unsafe.Pointer(&src[0]), C.int(length), unsafe.Pointer(&out[0]))
+	runtime.KeepAlive(src)
+	runtime.KeepAlive(out)
+	return dst[:n+int(size)]
+}
+
+// CompressInto compresses src into dst and returns the number of bytes
+// written, choosing the level like Compress. dst must be at least
+// CompressBound(len(src)) bytes long.
+func CompressInto(dst, src []byte) (int, error) {
+	length := len(src)
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+	if len(dst) < CompressBound(length) {
+		return 0, ErrOutputTooSmall
+	}
+
+	size := C.fastlz_compress(unsafe.Pointer(&src[0]), C.int(length), unsafe.Pointer(&dst[0]))
+	runtime.KeepAlive(src)
+	runtime.KeepAlive(dst)
+	return int(size), nil
+}
+
+// CompressLevelInto compresses src into dst with the given level and returns
+// the number of bytes written. dst must be at least CompressBound(len(src))
+// bytes long.
+func CompressLevelInto(dst, src []byte, level Level) (int, error) {
+	length := len(src)
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+	if len(dst) < CompressBound(length) {
+		return 0, ErrOutputTooSmall
+	}
+
+	var size C.int
+	switch level {
+	case Auto:
+		size = C.fastlz_compress(unsafe.Pointer(&src[0]), C.int(length), unsafe.Pointer(&dst[0]))
+	case Level1, Level2:
+		size = C.fastlz_compress_level(C.int(level), unsafe.Pointer(&src[0]), C.int(length), unsafe.Pointer(&dst[0]))
+	default:
+		return 0, ErrUnknownLevel
+	}
+	runtime.KeepAlive(src)
+	runtime.KeepAlive(dst)
+	return int(size), nil
+}
+
+// DecompressedLen returns the size of the decompressed data by walking the
+// token stream, without decompressing it. FastLZ has no such function, so
+// this runs the fastlzgo scanner. fastlz_decompress decodes every block it
+// accepts; the scanner also rejects a block ending in the middle of a
+// match, which fastlz_decompress reads past the input for.
+func DecompressedLen(input []byte) (int, error) {
+	return fastlzgo.DecompressedLen(input)
+}
+
+// Validate checks that input is a well-formed FastLZ block without
+// decompressing it, like fastlzgo.Validate.
+func Validate(input []byte) error {
+	return fastlzgo.Validate(input)
+}
+
+// AppendDecompress appends the decompressed src to dst and returns the
+// extended buffer. dst is only reallocated when its capacity is too small.
+func AppendDecompress(dst, src []byte) ([]byte, error) {
+	size, err := fastlzgo.DecompressedLen(src)
+	if err != nil {
+		return dst, err
+	}
+
+	n := len(dst)
+	dst = slices.Grow(dst, size)
+	size, err = decompress(dst[n:n+size], src)
+	if err != nil {
+		return dst[:n], err
+	}
+
+	return dst[:n+size], nil
+}
+
+// Decompress decompresses the input data with fastlz_decompress. The output
+// is sized by walking the token stream first, as fastlzgo.Decompress does.
+func Decompress(input []byte) ([]byte, error) {
+	size, err := fastlzgo.DecompressedLen(input)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, size)
+	n, err := decompress(result, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return result[:n], nil
+}
+
+// DecompressLimit decompresses the input data like Decompress, unless it
+// would decompress to more than maxOutput bytes. Then it fails with
+// ErrTooLarge as soon as the token walk passes the limit, before anything
+// is allocated.
+func DecompressLimit(input []byte, maxOutput int) ([]byte, error) {
+	size, err := fastlzgo.DecompressedLenLimit(input, maxOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, size)
+	n, err := decompress(result, input)
+	if err != nil {
+		return nil, err
+	}
+
+	return result[:n], nil
+}
+
+// DecompressInto decompresses the input data into dst and returns the number
+// of bytes written. ErrOutputTooSmall is returned if dst can not hold the
+// decompressed data.
+//
+// The block is walked by the fastlzgo scanner first: fastlz_decompress
+// reads past the input for some truncated blocks, and their result would
+// depend on bytes the caller did not pass.
+func DecompressInto(dst, input []byte) (int, error) {
+	size, err := fastlzgo.DecompressedLen(input)
+	if err != nil {
+		return 0, err
+	}
+	if size > len(dst) {
+		return 0, ErrOutputTooSmall
+	}
+
+	return decompress(dst, input)
+}
+
+func decompress(dst, input []byte) (int, error) {
+	if len(dst) == 0 {
+		return 0, ErrOutputTooSmall
+	}
+
+	size := C.fastlz_decompress(unsafe.Pointer(&input[0]), C.int(len(input)), unsafe.Pointer(&dst[0]), C.int(len(dst)))
+	runtime.KeepAlive(input)
+	runtime.KeepAlive(dst)
+
+	if size == 0 {
+		return 0, ErrCorrupt
+	}
+
+	return int(size), nil
+}
+
+// EncodeBlock encodes src as a self-describing block with
+// fastlz_compress_level: the uncompressed length as a uvarint, then the
+// FastLZ block. It writes the same bytes as fastlzgo.EncodeBlock, and the
+// result is written to dst if it is large enough.
+func EncodeBlock(dst, src []byte, level Level) ([]byte, error) {
+	switch level {
+	case Auto, Level1, Level2:
+	default:
+		return nil, ErrUnknownLevel
+	}
+
+	length := len(src)
+	if length > math.MaxInt32 {
+		return nil, errors.New("input too large for a block")
+	}
+	dst = binary.AppendUvarint(dst[:0], uint64(length))
+	if length == 0 {
+		return dst, nil
+	}
+
+	n := len(dst)
+	dst = slices.Grow(dst, CompressBound(length))
+	size, err := CompressLevelInto(dst[n:n+CompressBound(length)], src, level)
+	if err != nil {
+		return nil, err
+	}
+	return dst[:n+size], nil
+}
+
+// DecodedLen returns the uncompressed length declared by a block written by
+// EncodeBlock, without decompressing it.
+func DecodedLen(src []byte) (int, error) {
+	return fastlzgo.DecodedLen(src)
+}
+
+// DecodeBlock decodes a block written by EncodeBlock with fastlz_decompress
+// and returns the uncompressed data, written to dst if it is large enough.
+// The declared length is checked like fastlzgo.DecodeBlock does before the
+// output is allocated. Use DecodeBlockLimit for untrusted blocks.
+func DecodeBlock(dst, src []byte) ([]byte, error) {
+	return DecodeBlockLimit(dst, src, math.MaxInt32)
+}
+
+// DecodeBlockLimit is DecodeBlock, but it fails with ErrTooLarge if the
+// declared length is more than maxOutput, before reading the FastLZ block.
+func DecodeBlockLimit(dst, src []byte, maxOutput int) ([]byte, error) {
+	length, err := fastlzgo.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxOutput {
+		return nil, ErrTooLarge
+	}
+	_, n := binary.Uvarint(src)
+	block := src[n:]
+	if length == 0 {
+		if len(block) != 0 {
+			return nil, fmt.Errorf("%w: data after an empty block", ErrCorrupt)
+		}
+		return dst[:0], nil
+	}
+	if len(block) == 0 {
+		return nil, fmt.Errorf("%w: missing block", ErrCorrupt)
+	}
+
+	size, err := fastlzgo.DecompressedLenLimit(block, length)
+	if err == ErrTooLarge {
+		return nil, fmt.Errorf("%w: block decompresses to more than the %d bytes of its header", ErrCorrupt, length)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size != length {
+		return nil, fmt.Errorf("%w: block decompresses to %d bytes, header says %d", ErrCorrupt, size, length)
+	}
+
+	if cap(dst) < length {
+		dst = make([]byte, length)
+	}
+	dst = dst[:length]
+	if _, err := decompress(dst, block); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
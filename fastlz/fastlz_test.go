@@ -1,9 +1,12 @@
 package fastlz
 
 import (
+	"bytes"
 	"fmt"
+	"math/rand"
 	"testing"
 
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
 	"github.com/stretchr/testify/require"
 )
 
@@ -12,6 +15,120 @@ func TestEncodeDeoode(t *testing.T) {
 	enc, err := Compress(bt)
 	require.NoError(t, err)
 	fmt.Println(enc)
+	dec, err := Decompress(enc)
+	require.NoError(t, err)
+	require.Equal(t, bt, dec)
+}
+
+func TestCompressLevel(t *testing.T) {
+	bt := bytes.Repeat([]byte("hello fastlz level "), 5000)
+	for _, level := range []Level{Auto, Level1, Level2} {
+		enc, err := CompressLevel(bt, level)
+		require.NoError(t, err)
+		require.Less(t, len(enc), len(bt))
+	}
+
+	enc, err := CompressLevel(bt, Level2)
+	require.NoError(t, err)
+	require.Equal(t, byte(1), enc[0]>>5)
+
+	_, err = CompressLevel(bt, Level(3))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+	_, err = CompressLevel(nil, Level1)
+	require.ErrorIs(t, err, ErrEmptyInput)
+}
+
+func TestDecompress(t *testing.T) {
+	bt := bytes.Repeat([]byte("hello fastlz decompress "), 5000)
+	for _, level := range []Level{Level1, Level2} {
+		enc, err := CompressLevel(bt, level)
+		require.NoError(t, err)
+
+		dec, err := Decompress(enc)
+		require.NoError(t, err)
+		require.Equal(t, bt, dec)
+
+		dst := make([]byte, len(bt))
+		n, err := DecompressInto(dst, enc)
+		require.NoError(t, err)
+		require.Equal(t, bt, dst[:n])
+
+		_, err = DecompressInto(dst[:len(bt)-1], enc)
+		require.ErrorIs(t, err, ErrOutputTooSmall)
+
+		_, err = Decompress(enc[:len(enc)-1])
+		require.ErrorIs(t, err, ErrCorrupt)
+		var cerr *CorruptError
+		_, err = DecompressInto(dst, enc[:len(enc)-1])
+		require.ErrorAs(t, err, &cerr)
+	}
+
+	// a level 2 match cut off after its control byte; fastlz_decompress
+	// would read its distance from the byte past the input
+	var cerr *CorruptError
+	truncated := []byte{0x20, 'a', 0x20, 0x00}[:3]
+	_, err := DecompressInto(make([]byte, 16), truncated)
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, CorruptError{Offset: 2, Kind: fastlzgo.TokenMatch}, *cerr)
+
+	_, err = Decompress(nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+	_, err = DecompressInto(nil, nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+}
+
+func TestAppend(t *testing.T) {
+	bt := bytes.Repeat([]byte("hello fastlz append "), 5000)
+	enc, err := Compress(bt)
+	require.NoError(t, err)
+
+	prefix := []byte("prefix")
+	out := AppendCompress(prefix, bt)
+	require.Equal(t, prefix, out[:len(prefix)])
+	require.Equal(t, enc, out[len(prefix):])
+	require.Equal(t, prefix, AppendCompress(prefix, nil))
+
+	dst := make([]byte, CompressBound(len(bt)))
+	n, err := CompressInto(dst, bt)
+	require.NoError(t, err)
+	require.Equal(t, enc, dst[:n])
+	_, err = CompressInto(dst[:len(enc)], bt)
+	require.ErrorIs(t, err, ErrOutputTooSmall)
+	_, err = CompressInto(dst, nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+
+	dec, err := AppendDecompress(prefix, enc)
+	require.NoError(t, err)
+	require.Equal(t, prefix, dec[:len(prefix)])
+	require.Equal(t, bt, dec[len(prefix):])
+	_, err = AppendDecompress(nil, nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+
+	// no garbage once the buffers are large enough
+	cbuf := make([]byte, 0, CompressBound(len(bt)))
+	dbuf := make([]byte, 0, len(bt))
+	allocs := testing.AllocsPerRun(10, func() {
+		cbuf = AppendCompress(cbuf[:0], bt)
+		dbuf, err = AppendDecompress(dbuf[:0], cbuf)
+		if _, err := CompressInto(dst, bt); err != nil {
+			panic(err)
+		}
+		if _, err := DecompressInto(dbuf, cbuf); err != nil {
+			panic(err)
+		}
+	})
+	require.NoError(t, err)
+	require.Zero(t, allocs)
+}
+
+func BenchmarkAppendCompress(b *testing.B) {
+	bt := make([]byte, 2<<16)
+	dst := make([]byte, 0, CompressBound(len(bt)))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bt)))
+	for i := 0; i < b.N; i++ {
+		dst = AppendCompress(dst[:0], bt)
+	}
 }
 
 func BenchmarkCompress(b *testing.B) {
@@ -42,3 +159,94 @@ func BenchmarkCompress(b *testing.B) {
 		b.SetBytes(int64(len(bt)))
 	})
 }
+
+func TestBlock(t *testing.T) {
+	input := bytes.Repeat([]byte("hello fastlz block "), 5000)
+	for _, level := range []Level{Auto, Level1, Level2} {
+		enc, err := EncodeBlock(nil, input, level)
+		require.NoError(t, err)
+		goEnc, err := fastlzgo.EncodeBlock(nil, input, level)
+		require.NoError(t, err)
+		require.Equal(t, goEnc, enc)
+
+		n, err := DecodedLen(enc)
+		require.NoError(t, err)
+		require.Equal(t, len(input), n)
+
+		dec, err := DecodeBlock(make([]byte, 0, len(input)), enc)
+		require.NoError(t, err)
+		require.Equal(t, input, dec)
+	}
+
+	empty, err := EncodeBlock(nil, nil, Level1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, empty)
+	dec, err := DecodeBlock(nil, empty)
+	require.NoError(t, err)
+	require.Empty(t, dec)
+
+	enc, err := EncodeBlock(nil, input, Level1)
+	require.NoError(t, err)
+	for _, bad := range [][]byte{
+		enc[:3],
+		enc[:len(enc)-1],
+		append([]byte{0x99, 0xe6, 0x05}, enc[3:]...),
+		append([]byte{0}, enc[3:]...),
+	} {
+		_, err := DecodeBlock(nil, bad)
+		require.ErrorIs(t, err, ErrCorrupt)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	enc, err := Compress(bytes.Repeat([]byte("hello fastlz validate "), 5000))
+	require.NoError(t, err)
+	require.NoError(t, Validate(enc))
+	require.ErrorIs(t, Validate(enc[:len(enc)-1]), ErrCorrupt)
+
+	// fastlz_decompress decodes every block the scanner accepts. It also
+	// accepts a match cut off after its first byte at the end of the
+	// input, reading past it, which the scanner rejects.
+	rnd := rand.New(rand.NewSource(1))
+	out := make([]byte, 1<<20)
+	for i := 0; i < 100000; i++ {
+		block := make([]byte, 1+rnd.Intn(16), 32)
+		rnd.Read(block)
+		block[0] &= 1<<6 - 1
+		n, err := DecompressedLen(block)
+		if err != nil {
+			continue
+		}
+		m, err := decompress(out, block)
+		require.NoError(t, err, "%x", block)
+		require.Equal(t, n, m, "%x", block)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	// a literal and a level 2 match of about a megabyte at distance 1
+	bomb := []byte{1 << 5, 'a', 7 << 5}
+	bomb = append(bomb, bytes.Repeat([]byte{255}, 4000)...)
+	bomb = append(bomb, 0, 0)
+	size := 1 + 6 + 255*4000 + 3
+
+	dec, err := DecompressLimit(bomb, size)
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte{'a'}, size), dec)
+	_, err = DecompressLimit(bomb, size-1)
+	require.ErrorIs(t, err, ErrTooLarge)
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := DecompressLimit(bomb, 1<<16); err != ErrTooLarge {
+			panic(err)
+		}
+	})
+	require.Zero(t, allocs)
+
+	block, err := EncodeBlock(nil, dec, Level2)
+	require.NoError(t, err)
+	_, err = DecodeBlockLimit(nil, block, size-1)
+	require.ErrorIs(t, err, ErrTooLarge)
+	dec, err = DecodeBlockLimit(nil, block, size)
+	require.NoError(t, err)
+	require.Len(t, dec, size)
+}
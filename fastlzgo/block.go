@@ -0,0 +1,123 @@
+package fastlzgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// EncodeBlock encodes src as a self-describing block and returns it: the
+// uncompressed length as a uvarint, then the FastLZ block of CompressLevel
+// with the given level. An empty src encodes to the single byte 0. The
+// result is written to dst if it is large enough.
+//
+// Unlike the stream format of Writer, a block holds one buffer and carries
+// no checksum, like the Snappy block format. Blocks hold less than 2 GiB,
+// the limit of the cgo backend.
+func EncodeBlock(dst, src []byte, level Level) ([]byte, error) {
+	switch level {
+	case Auto, Level1, Level2:
+	default:
+		return nil, ErrUnknownLevel
+	}
+
+	length := len(src)
+	if length > math.MaxInt32 {
+		return nil, errors.New("input too large for a block")
+	}
+	dst = binary.AppendUvarint(dst[:0], uint64(length))
+	if length == 0 {
+		return dst, nil
+	}
+
+	n := len(dst)
+	dst = slices.Grow(dst, CompressBound(length))
+	out := dst[n : n+CompressBound(length)]
+	size := compressPooled(level, src, length, out)
+	return dst[:n+size], nil
+}
+
+// DecodedLen returns the uncompressed length declared by a block written by
+// EncodeBlock, without decompressing it.
+func DecodedLen(src []byte) (int, error) {
+	length, _, err := decodedLen(src)
+	return length, err
+}
+
+// DecodeBlock decodes a block written by EncodeBlock and returns the
+// uncompressed data, written to dst if it is large enough. The FastLZ block
+// is checked to decompress to exactly the declared length before the
+// output is allocated, so a corrupt length is rejected with ErrCorrupt
+// instead of being allocated. Use DecodeBlockLimit for untrusted blocks.
+func DecodeBlock(dst, src []byte) ([]byte, error) {
+	return DecodeBlockLimit(dst, src, math.MaxInt32)
+}
+
+// DecodeBlockLimit is DecodeBlock, but it fails with ErrTooLarge if the
+// declared length is more than maxOutput, before reading the FastLZ block.
+func DecodeBlockLimit(dst, src []byte, maxOutput int) ([]byte, error) {
+	length, n, err := decodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxOutput {
+		return nil, ErrTooLarge
+	}
+	if err := checkDeclaredLen(src[n:], length); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return dst[:0], nil
+	}
+
+	if cap(dst) < length {
+		dst = make([]byte, length)
+	}
+	dst = dst[:length]
+	if _, err := fastlzDecompress(src[n:], len(src)-n, dst, length); err != nil {
+		return nil, err
+	}
+	return dst, nil
+}
+
+// decodedLen returns the length declared by a block and the size of its
+// uvarint.
+func decodedLen(src []byte) (int, int, error) {
+	if len(src) == 0 {
+		return 0, 0, ErrEmptyInput
+	}
+	v, n := binary.Uvarint(src)
+	if n <= 0 || v > math.MaxInt32 {
+		return 0, 0, fmt.Errorf("%w: bad block length", ErrCorrupt)
+	}
+	return int(v), n, nil
+}
+
+// checkDeclaredLen checks that the FastLZ block decompresses to the length
+// declared in front of it. An empty length must come without a block.
+func checkDeclaredLen(block []byte, declared int) error {
+	if declared == 0 {
+		if len(block) != 0 {
+			return fmt.Errorf("%w: data after an empty block", ErrCorrupt)
+		}
+		return nil
+	}
+	if len(block) == 0 {
+		return fmt.Errorf("%w: missing block", ErrCorrupt)
+	}
+
+	/* the walk stops once the block passes the declared length */
+	size, err := fastlzDecodedLimit(block, len(block), declared)
+	if err == ErrTooLarge {
+		return fmt.Errorf("%w: block decompresses to more than the %d bytes of its header", ErrCorrupt, declared)
+	}
+	if err != nil {
+		return err
+	}
+	if size != declared {
+		return fmt.Errorf("%w: block decompresses to %d bytes, header says %d", ErrCorrupt, size, declared)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package fastlzgo
+
+import (
+	"fmt"
+	"slices"
+)
+
+// maxFarDistance is the longest distance a level 2 block can encode.
+const maxFarDistance = 65535 + MAX_DISTANCE2 + 1
+
+// BlockWriter assembles a compressed block from literals and matches chosen
+// by the caller, for custom parsers, test vectors and transcoders. It
+// encodes the tokens the way the encoders of this package do: literal runs
+// are split at 32 bytes, level 1 matches longer than 264 bytes are split,
+// and level 2 matches use the 255 length escape and 16-bit far distances.
+//
+// Tokens from a TokenReader written back in order give the same block for
+// the output of CompressLevel.
+type BlockWriter struct {
+	level   Level
+	out     []byte
+	ctrl    int /* offset of the control byte of the open literal run, -1 if none */
+	run     int /* length of the open literal run */
+	written int /* decompressed size so far */
+}
+
+// NewBlockWriter returns a BlockWriter for a block of the given level,
+// Level1 or Level2.
+func NewBlockWriter(level Level) (*BlockWriter, error) {
+	if level != Level1 && level != Level2 {
+		return nil, ErrUnknownLevel
+	}
+	return &BlockWriter{level: level, ctrl: -1}, nil
+}
+
+// Len returns the size of the data the block decompresses to so far.
+func (w *BlockWriter) Len() int {
+	return w.written
+}
+
+// Literal appends p to the block. Consecutive literals share runs, so
+// splitting p over several calls gives the same block.
+func (w *BlockWriter) Literal(p []byte) {
+	for len(p) > 0 {
+		if w.ctrl < 0 || w.run == MAX_COPY {
+			w.ctrl = len(w.out)
+			w.run = 0
+			w.out = append(w.out, 0)
+		}
+		n := min(len(p), MAX_COPY-w.run)
+		w.run += n
+		w.out[w.ctrl] = byte(w.run - 1)
+		w.out = append(w.out, p[:n]...)
+		w.written += n
+		p = p[n:]
+	}
+}
+
+// Match appends a copy of length bytes starting distance bytes back in the
+// decompressed data, 1 being the last byte. The copy may overlap the bytes
+// it produces. Matches are at least 3 bytes long and can not reach before
+// the start of the block, nor further than 8192 bytes at level 1 and 73727
+// bytes at level 2. A block can not start with a match.
+func (w *BlockWriter) Match(length, distance int) error {
+	maxDistance := MAX_DISTANCE1
+	if w.level == Level2 {
+		maxDistance = maxFarDistance
+	}
+	switch {
+	case length < 3:
+		return fmt.Errorf("%w: match of %d bytes", ErrInvalidToken, length)
+	case distance < 1 || distance > maxDistance:
+		return fmt.Errorf("%w: match distance %d out of range", ErrInvalidToken, distance)
+	case distance > w.written:
+		return fmt.Errorf("%w: match distance %d before the start of the block", ErrInvalidToken, distance)
+	}
+
+	/* at most a 3-byte token per 255 bytes of length, and a 3-byte far distance */
+	bound := 3*(length/(MAX_LEN-2)+1) + length/255 + 3
+	n := len(w.out)
+	w.out = slices.Grow(w.out, bound)[:n+bound]
+	if w.level == Level1 {
+		n = flz1Match(length-2, distance, w.out, n)
+	} else {
+		n = flz2Match(length-2, distance, w.out, n)
+	}
+	w.out = w.out[:n]
+	w.ctrl = -1
+	w.written += length
+	return nil
+}
+
+// Finish returns the block and makes the BlockWriter start a new one. A
+// block holds at least one byte.
+func (w *BlockWriter) Finish() ([]byte, error) {
+	if w.written == 0 {
+		return nil, ErrEmptyInput
+	}
+	block := w.out
+	if w.level == Level2 {
+		/* marker for fastlz2 */
+		block[0] |= 1 << 5
+	}
+	w.out = nil
+	w.ctrl = -1
+	w.written = 0
+	return block, nil
+}
@@ -1,15 +1,156 @@
 package fastlzgo
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Level selects the FastLZ compression level.
+type Level int
+
+const (
+	// Auto uses level 1 for inputs shorter than 64 KiB and level 2 otherwise,
+	// the same choice fastlz_compress makes.
+	Auto Level = 0
+	// Level1 is the fastest compression and generally useful for short data.
+	Level1 Level = 1
+	// Level2 is slightly slower but it gives better compression ratio.
+	Level2 Level = 2
+)
+
+// CompressBound returns the output buffer size needed to compress n bytes:
+// 5% larger than the input and not smaller than 66 bytes.
+func CompressBound(n int) int {
+	return max(66, n+(n+19)/20)
+}
 
 func Compress(input []byte) ([]byte, error) {
+	return CompressLevel(input, Auto)
+}
+
+// CompressLevel compresses the input data with the given compression level.
+// Auto keeps the behavior of Compress. The output is byte-for-byte identical
+// to fastlz_compress_level from FastLZ 0.5.0, used by the cgo package.
+func CompressLevel(input []byte, level Level) ([]byte, error) {
+	length := len(input)
+	if length == 0 {
+		return nil, ErrEmptyInput
+	}
+
+	output := make([]byte, CompressBound(length))
+	var size int
+	switch level {
+	case Auto, Level1, Level2:
+		size = compressPooled(level, input, length, output)
+	default:
+		return nil, ErrUnknownLevel
+	}
+
+	if size == 0 {
+		return nil, errors.New("error compressing data")
+	}
+
+	return output[:size], nil
+}
+
+// AppendCompress appends the compressed src to dst and returns the extended
+// buffer, choosing the level like Compress. Nothing is appended for an empty
+// src. dst is only reallocated when its capacity is too small.
+func AppendCompress(dst, src []byte) []byte {
+	length := len(src)
+	if length == 0 {
+		return dst
+	}
+
+	n := len(dst)
+	bound := CompressBound(length)
+	dst = slices.Grow(dst, bound)
+	size := compressPooled(Auto, src, length, dst[n:n+bound])
+	return dst[:n+size]
+}
+
+// CompressInto compresses src into dst and returns the number of bytes
+// written, choosing the level like Compress. dst must be at least
+// CompressBound(len(src)) bytes long.
+func CompressInto(dst, src []byte) (int, error) {
+	length := len(src)
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+	if len(dst) < CompressBound(length) {
+		return 0, ErrOutputTooSmall
+	}
+
+	return compressPooled(Auto, src, length, dst), nil
+}
+
+// CompressLevelInto compresses src into dst with the given level and returns
+// the number of bytes written. dst must be at least CompressBound(len(src))
+// bytes long.
+func CompressLevelInto(dst, src []byte, level Level) (int, error) {
+	length := len(src)
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+	if len(dst) < CompressBound(length) {
+		return 0, ErrOutputTooSmall
+	}
+
+	switch level {
+	case Auto, Level1, Level2:
+		return compressPooled(level, src, length, dst), nil
+	}
+	return 0, ErrUnknownLevel
+}
+
+// CompressedLen returns the length of Compress(input), without producing the
+// compressed data: level 1 below 64 KiB and level 2 from there on. It returns
+// 0 for an empty input.
+func CompressedLen(input []byte) int {
+	c := compressors.Get().(*Compressor)
+	size := c.compressedLen(Auto, input, len(input))
+	compressors.Put(c)
+	return size
+}
+
+// CompressedLenLevel returns the length of CompressLevel(input, level),
+// without producing the compressed data. With Level1 at any size, this is
+// the FastLZ length used by Solady's LibZip and the OP Stack Fjord fee
+// estimate.
+func CompressedLenLevel(input []byte, level Level) (int, error) {
+	switch level {
+	case Auto, Level1, Level2:
+	default:
+		return 0, ErrUnknownLevel
+	}
+	c := compressors.Get().(*Compressor)
+	size := c.compressedLen(level, input, len(input))
+	compressors.Put(c)
+	return size, nil
+}
+
+// CompressLegacy compresses the input data with the 2007 FastLZ encoder this
+// package used before the FastLZ 0.5.0 port, for callers that depend on its
+// exact output. Both encodings decompress with Decompress.
+func CompressLegacy(input []byte, level Level) ([]byte, error) {
 	length := len(input)
 	if length == 0 {
-		return nil, errors.New("no input provided")
+		return nil, ErrEmptyInput
 	}
 
-	output := make([]byte, length*2)
-	size := fastlzCompress(input, length, output)
+	output := make([]byte, CompressBound(length))
+	var size int
+	switch level {
+	case Auto:
+		size = fastlzCompress(input, length, output)
+	case Level1:
+		size = fastlz1Compress(input, length, output)
+	case Level2:
+		size = fastlz2Compress(input, length, output)
+	default:
+		return nil, ErrUnknownLevel
+	}
 
 	if size == 0 {
 		return nil, errors.New("error compressing data")
@@ -18,19 +159,147 @@ func Compress(input []byte) ([]byte, error) {
 	return output[:size], nil
 }
 
+// Decompress decompresses the input data. The decompressed size is found by
+// walking the token stream first, so the output is allocated exactly once
+// whatever the compression ratio.
 func Decompress(input []byte) ([]byte, error) {
 	length := len(input)
 	if length == 0 {
-		return nil, errors.New("no input provided")
+		return nil, ErrEmptyInput
+	}
+
+	maxLength, err := fastlzDecodedLen(input, length)
+	if err != nil {
+		return nil, err
 	}
 
-	maxLength := length * 2
 	output := make([]byte, maxLength)
-	size := fastlzDecompress(input, length, output, maxLength)
+	size, err := fastlzDecompress(input, length, output, maxLength)
+	if err != nil {
+		return nil, err
+	}
 
-	if size == 0 {
-		return nil, errors.New("error decompressing data")
+	return output[:size], nil
+}
+
+// DecompressLimit decompresses the input data like Decompress, unless it
+// would decompress to more than maxOutput bytes. Then it fails with
+// ErrTooLarge as soon as the token walk passes the limit, before anything
+// is allocated. A level 2 block expands up to 255 times, so use it rather
+// than Decompress for untrusted input.
+func DecompressLimit(input []byte, maxOutput int) ([]byte, error) {
+	length := len(input)
+	if length == 0 {
+		return nil, ErrEmptyInput
+	}
+
+	size, err := DecompressedLenLimit(input, maxOutput)
+	if err != nil {
+		return nil, err
+	}
+
+	output := make([]byte, size)
+	size, err = fastlzDecompress(input, length, output, size)
+	if err != nil {
+		return nil, err
 	}
 
 	return output[:size], nil
 }
+
+// AppendDecompress appends the decompressed src to dst and returns the
+// extended buffer. dst is only reallocated when its capacity is too small.
+func AppendDecompress(dst, src []byte) ([]byte, error) {
+	length := len(src)
+	if length == 0 {
+		return dst, ErrEmptyInput
+	}
+
+	size, err := fastlzDecodedLen(src, length)
+	if err != nil {
+		return dst, err
+	}
+
+	n := len(dst)
+	dst = slices.Grow(dst, size)
+	size, err = fastlzDecompress(src, length, dst[n:n+size], size)
+	if err != nil {
+		return dst[:n], err
+	}
+
+	return dst[:n+size], nil
+}
+
+// DecompressInto decompresses the input data into dst and returns the number
+// of bytes written. ErrOutputTooSmall is returned if dst can not hold the
+// decompressed data.
+func DecompressInto(dst, input []byte) (int, error) {
+	length := len(input)
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+
+	return fastlzDecompress(input, length, dst, len(dst))
+}
+
+// DecompressedLen returns the size of the decompressed data by walking the
+// token stream, without decompressing it. It fails exactly when Decompress
+// would, with the same *CorruptError. Unlike DecodedLen, which reads the
+// length in front of an EncodeBlock block, it takes a raw FastLZ block.
+func DecompressedLen(input []byte) (int, error) {
+	return fastlzDecodedLen(input, len(input))
+}
+
+// DecompressedLenLimit is DecompressedLen, but it stops with ErrTooLarge as
+// soon as the walk passes limit decompressed bytes, so checking a bomb
+// against a limit costs no more than the limit allows.
+func DecompressedLenLimit(input []byte, limit int) (int, error) {
+	return fastlzDecodedLimit(input, len(input), max(limit, 0))
+}
+
+// Validate checks that input is a well-formed FastLZ block without
+// decompressing it: the level bits of the first byte are 1 or 2, no token
+// runs past the end and every match refers to bytes already decompressed.
+// A malformed block gives a *CorruptError with the offset of the first bad
+// token.
+func Validate(input []byte) error {
+	_, err := fastlzDecodedLen(input, len(input))
+	return err
+}
+
+// DecompressSize decompresses the input data whose original size is known,
+// for example because it was stored next to the compressed block.
+// A negative originalSize means the size is unknown, as in Decompress.
+//
+// originalSize is also the limit: the block is walked first and the output
+// is only allocated once the block is known to decompress to exactly
+// originalSize bytes. ErrOutputTooSmall is returned if it decompresses to
+// more.
+func DecompressSize(input []byte, originalSize int) ([]byte, error) {
+	if originalSize < 0 {
+		return Decompress(input)
+	}
+
+	length := len(input)
+	if length == 0 {
+		return nil, ErrEmptyInput
+	}
+
+	size, err := fastlzDecodedLimit(input, length, originalSize)
+	if err == ErrTooLarge {
+		return nil, ErrOutputTooSmall
+	}
+	if err != nil {
+		return nil, err
+	}
+	if size != originalSize {
+		return nil, fmt.Errorf("%w: decompressed %d bytes, expected %d", ErrCorrupt, size, originalSize)
+	}
+
+	output := make([]byte, originalSize)
+	if _, err := fastlzDecompress(input, length, output, originalSize); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,82 @@
+package fastlzgo
+
+import (
+	"slices"
+	"sync"
+)
+
+// Compressor compresses blocks like CompressLevel, keeping its hash table
+// between calls. Every block still starts from an empty table: rather than
+// zeroing the table, a Compressor moves a base position past the previous
+// block so that older entries read as empty.
+//
+// The zero value compresses like Compress. A Compressor must not be used
+// by multiple goroutines at the same time.
+type Compressor struct {
+	level Level
+	htab  [HASH_SIZE]uint32
+	base  uint32
+}
+
+// NewCompressor returns a Compressor for the given compression level.
+func NewCompressor(level Level) (*Compressor, error) {
+	switch level {
+	case Auto, Level1, Level2:
+		return &Compressor{level: level}, nil
+	}
+	return nil, ErrUnknownLevel
+}
+
+// Compress compresses the input data into a new buffer.
+func (c *Compressor) Compress(input []byte) ([]byte, error) {
+	length := len(input)
+	if length == 0 {
+		return nil, ErrEmptyInput
+	}
+
+	output := make([]byte, CompressBound(length))
+	size := c.compress(c.level, input, length, output)
+	return output[:size], nil
+}
+
+// AppendCompress appends the compressed src to dst and returns the extended
+// buffer. Nothing is appended for an empty src.
+func (c *Compressor) AppendCompress(dst, src []byte) []byte {
+	length := len(src)
+	if length == 0 {
+		return dst
+	}
+
+	n := len(dst)
+	bound := CompressBound(length)
+	dst = slices.Grow(dst, bound)
+	size := c.compress(c.level, src, length, dst[n:n+bound])
+	return dst[:n+size]
+}
+
+// CompressInto compresses src into dst and returns the number of bytes
+// written. dst must be at least CompressBound(len(src)) bytes long.
+func (c *Compressor) CompressInto(dst, src []byte) (int, error) {
+	length := len(src)
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+	if len(dst) < CompressBound(length) {
+		return 0, ErrOutputTooSmall
+	}
+
+	return c.compress(c.level, src, length, dst), nil
+}
+
+// compressors backs the package level functions, so that they neither
+// allocate nor zero a hash table per call.
+var compressors = sync.Pool{
+	New: func() any { return new(Compressor) },
+}
+
+func compressPooled(level Level, input []byte, length int, output []byte) int {
+	c := compressors.Get().(*Compressor)
+	size := c.compress(level, input, length, output)
+	compressors.Put(c)
+	return size
+}
@@ -0,0 +1,179 @@
+package fastlzgo
+
+import "math"
+
+// CostFunc returns the cost of emitting the byte b in the compressed output.
+type CostFunc func(b byte) uint64
+
+// CalldataCost is the EVM calldata gas of b: 4 for a zero byte and 16
+// otherwise.
+func CalldataCost(b byte) uint64 {
+	if b == 0 {
+		return 4
+	}
+	return 16
+}
+
+const (
+	costMinMatch   = 3
+	costMaxMatch   = 264 /* 6 + 255 extra + 3 */
+	costChainDepth = 64
+	costGoodMatch  = 32  /* a match this long ends the chain walk */
+	costMaxCompare = 512 /* bytes compared per position before the walk ends */
+)
+
+/* the cheapest way found to encode input[:i] */
+type costNode struct {
+	cost     uint64
+	size     int /* output bytes, to break ties */
+	length   int /* length of the last token */
+	distance int /* distance of the last match, 0 for a literal run */
+}
+
+// CompressCost compresses the input at level 1, choosing literal runs and
+// matches to minimize the total cost of the output bytes instead of its
+// length. The result decodes with any FastLZ level 1 decoder, including
+// Decompress, fastlz_decompress and Solady's LibZip.flzDecompress.
+//
+// The parse is found by dynamic programming over the matches found by a
+// hash chain, so it costs noticeably more time than CompressLevel. The
+// chain walk at each position ends at the first match of 32 bytes or more,
+// after 64 entries, or once 512 bytes have been compared, and positions
+// inside such a match are not searched again but for its last 32 bytes.
+// Whatever the input, each byte costs at most 776 byte comparisons and
+// about as many cost updates.
+func CompressCost(input []byte, cost CostFunc) ([]byte, error) {
+	length := len(input)
+	if length == 0 {
+		return nil, ErrEmptyInput
+	}
+
+	var byteCost [256]uint64
+	for b := range byteCost {
+		byteCost[b] = cost(byte(b))
+	}
+
+	/* prefix sums of the literal costs */
+	litCost := make([]uint64, length+1)
+	for i, b := range input {
+		litCost[i+1] = litCost[i] + byteCost[b]
+	}
+
+	nodes := make([]costNode, length+1)
+	for i := 1; i <= length; i++ {
+		nodes[i].cost = math.MaxUint64
+	}
+	relax := func(from, to int, c uint64, size, distance int) {
+		c += nodes[from].cost
+		size += nodes[from].size
+		n := &nodes[to]
+		if c < n.cost || (c == n.cost && size < n.size) {
+			*n = costNode{cost: c, size: size, length: to - from, distance: distance}
+		}
+	}
+
+	var head [HASH_SIZE]int32
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, length)
+
+	/* cheapest distance per match length, for lengths of 9 and more */
+	var longCost [costMaxMatch + 1]uint64
+	var longDistance [costMaxMatch + 1]int
+
+	/* positions inside a long match are not searched again */
+	searchFrom := 1
+	for i := 0; i < length; i++ {
+		if nodes[i].cost == math.MaxUint64 {
+			continue
+		}
+
+		for run := 1; run <= MAX_COPY && i+run <= length; run++ {
+			relax(i, i+run, byteCost[run-1]+litCost[i+run]-litCost[i], run+1, 0)
+		}
+
+		if i+costMinMatch > length {
+			continue
+		}
+
+		/* the stream starts with a literal run, which carries the level */
+		if i >= searchFrom {
+			maxLen, compared := 0, 0
+			for p, depth := head[costHash(input, i)], 0; p >= 0 && depth < costChainDepth && compared < costMaxCompare; p, depth = prev[p], depth+1 {
+				distance := i - int(p)
+				if distance > MAX_DISTANCE1 {
+					break
+				}
+				n := 0
+				for n < costMaxMatch && i+n < length && input[int(p)+n] == input[i+n] {
+					n++
+				}
+				compared += n + 1
+				if n < costMinMatch {
+					continue
+				}
+
+				ofs := distance - 1
+				lo := byteCost[ofs&255]
+				for l := costMinMatch; l <= min(n, 8); l++ {
+					relax(i, i+l, byteCost[((l-2)<<5)+(ofs>>8)]+lo, 2, distance)
+				}
+				/* longer matches share a control byte, so only the distance changes the cost */
+				c := byteCost[(7<<5)+(ofs>>8)] + lo
+				for l := max(9, maxLen+1); l <= n; l++ {
+					longCost[l] = math.MaxUint64
+				}
+				for l := 9; l <= n; l++ {
+					if c < longCost[l] {
+						longCost[l] = c
+						longDistance[l] = distance
+					}
+				}
+				maxLen = max(maxLen, n)
+				if n >= costGoodMatch {
+					break /* good enough, the rest of the chain rarely pays */
+				}
+			}
+			for l := 9; l <= maxLen; l++ {
+				relax(i, i+l, longCost[l]+byteCost[l-9], 3, longDistance[l])
+			}
+			if maxLen >= costGoodMatch {
+				searchFrom = i + maxLen - costGoodMatch + 1
+			}
+		}
+
+		h := costHash(input, i)
+		prev[i] = head[h]
+		head[h] = int32(i)
+	}
+
+	/* walk the parse back to front, then emit it */
+	tokens := make([]int, 0, length/4)
+	for i := length; i > 0; i -= nodes[i].length {
+		tokens = append(tokens, i)
+	}
+
+	output := make([]byte, 0, nodes[length].size)
+	for t := len(tokens) - 1; t >= 0; t-- {
+		n := nodes[tokens[t]]
+		from := tokens[t] - n.length
+		if n.distance == 0 {
+			output = append(output, byte(n.length-1))
+			output = append(output, input[from:tokens[t]]...)
+			continue
+		}
+		ofs := n.distance - 1
+		if n.length <= 8 {
+			output = append(output, byte(((n.length-2)<<5)+(ofs>>8)), byte(ofs&255))
+		} else {
+			output = append(output, byte((7<<5)+(ofs>>8)), byte(n.length-9), byte(ofs&255))
+		}
+	}
+
+	return output, nil
+}
+
+func costHash(input []byte, p int) uint32 {
+	return flzHash(uint32(input[p]) | uint32(input[p+1])<<8 | uint32(input[p+2])<<16)
+}
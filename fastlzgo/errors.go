@@ -0,0 +1,73 @@
+package fastlzgo
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrEmptyInput is returned when there is no input to compress or decompress.
+	ErrEmptyInput = errors.New("no input provided")
+	// ErrCorrupt is returned when compressed data can not be decoded.
+	// Decoders return a *CorruptError that matches it with errors.Is.
+	ErrCorrupt = errors.New("corrupt input")
+	// ErrOutputTooSmall is returned when the output buffer can not hold the
+	// result. Retrying with a larger buffer may succeed.
+	ErrOutputTooSmall = errors.New("output buffer too small")
+	// ErrUnknownLevel is returned for a compression level other than Auto,
+	// Level1 or Level2.
+	ErrUnknownLevel = errors.New("unknown compression level")
+	// ErrTooLarge is returned when compressed data would decompress to more
+	// than the limit set with DecompressLimit or WithMaxDecodedSize.
+	ErrTooLarge = errors.New("decompressed data exceeds the size limit")
+	// ErrInvalidToken is returned by BlockWriter for a match the block format
+	// can not encode.
+	ErrInvalidToken = errors.New("token can not be encoded")
+)
+
+// TokenKind identifies the parts of a compressed block.
+type TokenKind int
+
+const (
+	// TokenHeader is the level marker in the top 3 bits of the first byte.
+	TokenHeader TokenKind = iota
+	// TokenLiteral is a run of up to 32 bytes copied from the input.
+	TokenLiteral
+	// TokenMatch is a back-reference to bytes already decompressed.
+	TokenMatch
+	// TokenFarMatch is a level 2 back-reference with a 16-bit distance.
+	TokenFarMatch
+)
+
+func (k TokenKind) String() string {
+	switch k {
+	case TokenHeader:
+		return "header"
+	case TokenLiteral:
+		return "literal"
+	case TokenMatch:
+		return "match"
+	case TokenFarMatch:
+		return "far match"
+	}
+	return fmt.Sprintf("TokenKind(%d)", int(k))
+}
+
+// CorruptError reports the token a decoder failed on.
+type CorruptError struct {
+	Offset int       // offset of the token in the compressed input
+	Kind   TokenKind // kind of the token
+}
+
+func corruptError(offset uint, kind TokenKind) *CorruptError {
+	return &CorruptError{Offset: int(offset), Kind: kind}
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupt input: bad %s at offset %d", e.Kind, e.Offset)
+}
+
+// Is reports whether target is ErrCorrupt.
+func (e *CorruptError) Is(target error) bool {
+	return target == ErrCorrupt
+}
@@ -28,14 +28,13 @@ package fastlzgo
 
 import (
 	"math"
-	"unsafe"
 )
 
 /*
  * Always check for bound when decompressing.
  * Generally it is best to leave it defined.
  */
-// FASTLZ_SAFE - will leave it
+// FASTLZ_SAFE - always on, every read of the input is checked
 
 /*
  * Give hints to the compiler for branch prediction optimization.
@@ -104,17 +103,24 @@ func fastlzCompress(input []byte, length int, output []byte) int {
 /*
 Decompress a block of compressed data and returns the size of the
 decompressed block. If error occurs, e.g. the compressed data is
-corrupted or the output buffer is not large enough, then 0 (zero)
-will be returned instead.
+corrupted or the output buffer is not large enough, then a *CorruptError
+or ErrOutputTooSmall will be returned instead.
 
 The input buffer and the output buffer can not overlap.
 
 Decompression is memory safe and guaranteed not to write the output buffer
 more than what is specified in maxout.
 */
-func fastlzDecompress(input []byte, length int, output []byte, maxout int) int {
+func fastlzDecompress(input []byte, length int, output []byte, maxout int) (int, error) {
+	/* never read or write past the slices */
+	length = min(length, len(input))
+	maxout = min(maxout, len(output))
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+
 	/* magic identifier for compression level */
-	level := ((*(*uint8)(unsafe.Pointer(&input[0]))) >> 5) + 1
+	level := (input[0] >> 5) + 1
 
 	if level == 1 {
 		return fastlz1Decompress(input, length, output, maxout)
@@ -123,7 +129,42 @@ func fastlzDecompress(input []byte, length int, output []byte, maxout int) int {
 		return fastlz2Decompress(input, length, output, maxout)
 	}
 	/* unknown level, trigger error */
-	return 0
+	return 0, corruptError(0, TokenHeader)
+}
+
+/*
+Walk the tokens of a compressed block and return the size of the
+decompressed block without writing any output. If the compressed data
+is corrupted, then a *CorruptError will be returned instead.
+
+This accepts exactly the blocks fastlzDecompress accepts, so its result
+can be used as maxout to decompress into an exactly sized buffer.
+*/
+func fastlzDecodedLen(input []byte, length int) (int, error) {
+	return fastlzDecodedLimit(input, length, math.MaxInt)
+}
+
+/*
+Like fastlzDecodedLen, but stop with ErrTooLarge as soon as the
+decompressed block grows past limit bytes.
+*/
+func fastlzDecodedLimit(input []byte, length int, limit int) (int, error) {
+	length = min(length, len(input))
+	if length == 0 {
+		return 0, ErrEmptyInput
+	}
+
+	/* magic identifier for compression level */
+	level := (input[0] >> 5) + 1
+
+	if level == 1 {
+		return fastlz1DecodedLen(input, length, uint(limit))
+	}
+	if level == 2 {
+		return fastlz2DecodedLen(input, length, uint(limit))
+	}
+	/* unknown level, trigger error */
+	return 0, corruptError(0, TokenHeader)
 }
 
 /*
@@ -146,6 +187,8 @@ Level 2 is slightly slower but it gives better compression ratio.
 
 Note that the compressed data, regardless of the level, can always be
 decompressed using the function fastlz_decompress above.
+
+Deprecated: use CompressLevel, which sizes the output buffer itself.
 */
 func Fastlz_compress_level(level int, input []byte, length int, output []byte) int {
 	if len(output) < int(math.Max(66, float64(length)*1.05)) {
@@ -167,9 +210,11 @@ func fastlz1Compress(input []byte, length int, output []byte) int {
 
 	var ip uint = 0
 	var ip_bound uint = uint(length - 2)
-	var ip_limit uint = uint(length)
-	if ip_limit >= 12 {
-		ip_limit -= 12
+	/* ip + length - 12 is before the input for short blocks, so the */
+	/* main loop never runs and the block is one literal run, as in C */
+	var ip_limit uint = 0
+	if length >= 12 {
+		ip_limit = uint(length - 12)
 	}
 
 	var op uint = 0
@@ -186,7 +231,7 @@ func fastlz1Compress(input []byte, length int, output []byte) int {
 		return length + 1
 	}
 
-	var htab [HASH_SIZE]uint
+	var htab [HASH_SIZE]uint32
 	var hslot uint
 	var hval uint
 
@@ -225,13 +270,13 @@ func fastlz1Compress(input []byte, length int, output []byte) int {
 		hval &= HASH_MASK
 
 		hslot = hval
-		ref = htab[hval]
+		ref = uint(htab[hval])
 
 		/* calculate distance to the match */
 		distance = anchor - ref
 
 		/* update hash table */
-		htab[hslot] = anchor
+		htab[hslot] = uint32(anchor)
 
 		/* is this a match? check the first 3 bytes */
 		if distance == 0 ||
@@ -358,12 +403,12 @@ func fastlz1Compress(input []byte, length int, output []byte) int {
 		hval = (uint(input[ip]) | uint(input[ip+1])<<8)
 		hval ^= (uint(input[ip+1]) | uint(input[ip+2])<<8) ^ (hval >> (16 - HASH_LOG))
 		hval &= HASH_MASK
-		htab[hval] = ip
+		htab[hval] = uint32(ip)
 		ip++
 		hval = (uint(input[ip]) | uint(input[ip+1])<<8)
 		hval ^= (uint(input[ip+1]) | uint(input[ip+2])<<8) ^ (hval >> (16 - HASH_LOG))
 		hval &= HASH_MASK
-		htab[hval] = ip
+		htab[hval] = uint32(ip)
 		ip++
 
 		/* assuming literal copy */
@@ -416,9 +461,11 @@ func fastlz2Compress(input []byte, length int, output []byte) int {
 
 	var ip uint = 0
 	var ip_bound uint = uint(length - 2)
-	var ip_limit uint = uint(length)
-	if ip_limit >= 12 {
-		ip_limit -= 12
+	/* ip + length - 12 is before the input for short blocks, so the */
+	/* main loop never runs and the block is one literal run, as in C */
+	var ip_limit uint = 0
+	if length >= 12 {
+		ip_limit = uint(length - 12)
 	}
 
 	var op uint = 0
@@ -435,7 +482,7 @@ func fastlz2Compress(input []byte, length int, output []byte) int {
 		return length + 1
 	}
 
-	var htab [HASH_SIZE]uint
+	var htab [HASH_SIZE]uint32
 	var hslot uint
 	var hval uint
 
@@ -479,13 +526,13 @@ func fastlz2Compress(input []byte, length int, output []byte) int {
 		hval &= HASH_MASK
 
 		hslot = hval
-		ref = htab[hval]
+		ref = uint(htab[hval])
 
 		/* calculate distance to the match */
 		distance = anchor - ref
 
 		/* update hash table */
-		htab[hslot] = anchor
+		htab[hslot] = uint32(anchor)
 
 		/* is this a match? check the first 3 bytes */
 		if distance == 0 ||
@@ -648,12 +695,12 @@ func fastlz2Compress(input []byte, length int, output []byte) int {
 		hval = (uint(input[ip]) | uint(input[ip+1])<<8)
 		hval ^= (uint(input[ip+1]) | uint(input[ip+2])<<8) ^ (hval >> (16 - HASH_LOG))
 		hval &= HASH_MASK
-		htab[hval] = ip
+		htab[hval] = uint32(ip)
 		ip++
 		hval = (uint(input[ip]) | uint(input[ip+1])<<8)
 		hval ^= (uint(input[ip+1]) | uint(input[ip+2])<<8) ^ (hval >> (16 - HASH_LOG))
 		hval &= HASH_MASK
-		htab[hval] = ip
+		htab[hval] = uint32(ip)
 		ip++
 
 		/* assuming literal copy */
@@ -702,7 +749,7 @@ func fastlz2Compress(input []byte, length int, output []byte) int {
 	return int(op)
 }
 
-func fastlz1Decompress(input []byte, length int, output []byte, maxout int) int {
+func fastlz1Decompress(input []byte, length int, output []byte, maxout int) (int, error) {
 	var ip uint = 0
 	var ip_limit uint = uint(length)
 	var op uint = 0
@@ -712,6 +759,7 @@ func fastlz1Decompress(input []byte, length int, output []byte, maxout int) int
 	loop := true
 
 	for loop {
+		anchor := ip - 1
 		ref := op
 		len := ctrl >> 5
 		ofs := (ctrl & 31) << 8
@@ -720,17 +768,23 @@ func fastlz1Decompress(input []byte, length int, output []byte, maxout int) int
 			len--
 			ref -= ofs
 			if len == 7-1 {
+				if ip >= ip_limit {
+					return 0, corruptError(anchor, TokenMatch)
+				}
 				len += uint(input[ip])
 				ip++
 			}
+			if ip >= ip_limit {
+				return 0, corruptError(anchor, TokenMatch)
+			}
 			ref -= uint(input[ip])
 			ip++
 
 			if op+len+3 > op_limit {
-				return 0
+				return 0, ErrOutputTooSmall
 			}
 			if int(ref-1) < 0 {
-				return 0
+				return 0, corruptError(anchor, TokenMatch)
 			}
 			if ip < ip_limit {
 				ctrl = uint(input[ip])
@@ -774,10 +828,10 @@ func fastlz1Decompress(input []byte, length int, output []byte, maxout int) int
 		} else {
 			ctrl++
 			if op+ctrl > op_limit {
-				return 0
+				return 0, ErrOutputTooSmall
 			}
 			if ip+ctrl > ip_limit {
-				return 0
+				return 0, corruptError(anchor, TokenLiteral)
 			}
 			output[op] = input[ip]
 			op++
@@ -795,10 +849,10 @@ func fastlz1Decompress(input []byte, length int, output []byte, maxout int) int
 		}
 	}
 
-	return int(op)
+	return int(op), nil
 }
 
-func fastlz2Decompress(input []byte, length int, output []byte, maxout int) int {
+func fastlz2Decompress(input []byte, length int, output []byte, maxout int) (int, error) {
 	var ip uint = 0
 	var ip_limit uint = uint(length)
 	var op uint = 0
@@ -808,6 +862,7 @@ func fastlz2Decompress(input []byte, length int, output []byte, maxout int) int
 	loop := true
 
 	for loop {
+		anchor := ip - 1
 		ref := op
 		len := ctrl >> 5
 		ofs := (ctrl & 31) << 8
@@ -819,18 +874,29 @@ func fastlz2Decompress(input []byte, length int, output []byte, maxout int) int
 			if len == 7-1 {
 				code = 255
 				for code == 255 {
+					if ip >= ip_limit {
+						return 0, corruptError(anchor, TokenMatch)
+					}
 					code = input[ip]
 					ip++
 					len += uint(code)
 				}
 			}
+			if ip >= ip_limit {
+				return 0, corruptError(anchor, TokenMatch)
+			}
 			code = input[ip]
 			ip++
 			ref -= uint(code)
+			kind := TokenMatch
 
 			/* match from 16-bit distance */
 			if code == 255 {
 				if ofs == (31 << 8) {
+					kind = TokenFarMatch
+					if ip+2 > ip_limit {
+						return 0, corruptError(anchor, kind)
+					}
 					ofs = uint(input[ip]) << 8
 					ip++
 					ofs += uint(input[ip])
@@ -839,10 +905,10 @@ func fastlz2Decompress(input []byte, length int, output []byte, maxout int) int
 				}
 			}
 			if op+len+3 > op_limit {
-				return 0
+				return 0, ErrOutputTooSmall
 			}
 			if int(ref-1) < 0 {
-				return 0
+				return 0, corruptError(anchor, kind)
 			}
 			if ip < ip_limit {
 				ctrl = uint(input[ip])
@@ -886,10 +952,10 @@ func fastlz2Decompress(input []byte, length int, output []byte, maxout int) int
 		} else {
 			ctrl++
 			if op+ctrl > op_limit {
-				return 0
+				return 0, ErrOutputTooSmall
 			}
 			if ip+ctrl > ip_limit {
-				return 0
+				return 0, corruptError(anchor, TokenLiteral)
 			}
 			output[op] = input[ip]
 			op++
@@ -907,5 +973,126 @@ func fastlz2Decompress(input []byte, length int, output []byte, maxout int) int
 		}
 	}
 
-	return int(op)
+	return int(op), nil
+}
+
+func fastlz1DecodedLen(input []byte, length int, limit uint) (int, error) {
+	var ip uint = 0
+	var ip_limit uint = uint(length)
+	var op uint = 0
+	var ctrl uint = uint(input[ip] & 31)
+	ip++
+
+	for {
+		anchor := ip - 1
+		if ctrl >= 32 {
+			len := (ctrl >> 5) - 1
+			ofs := (ctrl & 31) << 8
+			if len == 7-1 {
+				if ip >= ip_limit {
+					return 0, corruptError(anchor, TokenMatch)
+				}
+				len += uint(input[ip])
+				ip++
+			}
+			if ip >= ip_limit {
+				return 0, corruptError(anchor, TokenMatch)
+			}
+			ofs += uint(input[ip])
+			ip++
+
+			/* the reference must point into the output produced so far */
+			if ofs+1 > op {
+				return 0, corruptError(anchor, TokenMatch)
+			}
+			op += len + 3
+		} else {
+			ctrl++
+			if ip+ctrl > ip_limit {
+				return 0, corruptError(anchor, TokenLiteral)
+			}
+			ip += ctrl
+			op += ctrl
+		}
+		if op > limit {
+			return 0, ErrTooLarge
+		}
+
+		if ip >= ip_limit {
+			break
+		}
+		ctrl = uint(input[ip])
+		ip++
+	}
+
+	return int(op), nil
+}
+
+func fastlz2DecodedLen(input []byte, length int, limit uint) (int, error) {
+	var ip uint = 0
+	var ip_limit uint = uint(length)
+	var op uint = 0
+	var ctrl uint = uint(input[ip] & 31)
+	ip++
+
+	for {
+		anchor := ip - 1
+		if ctrl >= 32 {
+			var code byte
+			len := (ctrl >> 5) - 1
+			ofs := (ctrl & 31) << 8
+			if len == 7-1 {
+				code = 255
+				for code == 255 {
+					if ip >= ip_limit {
+						return 0, corruptError(anchor, TokenMatch)
+					}
+					code = input[ip]
+					ip++
+					len += uint(code)
+				}
+			}
+			if ip >= ip_limit {
+				return 0, corruptError(anchor, TokenMatch)
+			}
+			code = input[ip]
+			ip++
+			distance := ofs + uint(code) + 1
+			kind := TokenMatch
+
+			/* match from 16-bit distance */
+			if code == 255 && ofs == (31<<8) {
+				kind = TokenFarMatch
+				if ip+2 > ip_limit {
+					return 0, corruptError(anchor, kind)
+				}
+				distance = uint(input[ip])<<8 + uint(input[ip+1]) + MAX_DISTANCE2 + 1
+				ip += 2
+			}
+
+			/* the reference must point into the output produced so far */
+			if distance > op {
+				return 0, corruptError(anchor, kind)
+			}
+			op += len + 3
+		} else {
+			ctrl++
+			if ip+ctrl > ip_limit {
+				return 0, corruptError(anchor, TokenLiteral)
+			}
+			ip += ctrl
+			op += ctrl
+		}
+		if op > limit {
+			return 0, ErrTooLarge
+		}
+
+		if ip >= ip_limit {
+			break
+		}
+		ctrl = uint(input[ip])
+		ip++
+	}
+
+	return int(op), nil
 }
@@ -0,0 +1,525 @@
+/*
+  FastLZ - Byte-aligned LZ77 compression library
+  Copyright (C) 2005-2020 Ariya Hidayat <ariya.hidayat@gmail.com>
+
+  Permission is hereby granted, free of charge, to any person obtaining a copy
+  of this software and associated documentation files (the "Software"), to deal
+  in the Software without restriction, including without limitation the rights
+  to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+  copies of the Software, and to permit persons to whom the Software is
+  furnished to do so, subject to the following conditions:
+
+  The above copyright notice and this permission notice shall be included in
+  all copies or substantial portions of the Software.
+
+  THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+  IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+  FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+  AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+  LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+  OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+  THE SOFTWARE.
+
+  This is a port of the FastLZ 0.5.0 encoder vendored by the cgo package:
+  https://github.com/ariya/FastLZ/tree/344eb4025f9ae866ebf7a2ec48850f7113a97a42
+  Its output is byte-for-byte identical to fastlz_compress_level.
+*/
+
+package fastlzgo
+
+import (
+	"encoding/binary"
+	"math"
+	"math/bits"
+)
+
+func flzReadU32(input []byte, p int) uint32 {
+	return binary.LittleEndian.Uint32(input[p:])
+}
+
+func flzHash(v uint32) uint32 {
+	h := (uint64(v) * 2654435769) >> (32 - HASH_LOG)
+	return uint32(h) & HASH_MASK
+}
+
+/*
+Count the matching bytes of input[p:] and input[q:], stopping at r.
+The first mismatching byte is included in the count, as in flz_cmp.
+*/
+func flzCmp(input []byte, p int, q int, r int) int {
+	start := p
+	for q+8 <= r {
+		x := binary.LittleEndian.Uint64(input[p:]) ^ binary.LittleEndian.Uint64(input[q:])
+		if x != 0 {
+			return p + bits.TrailingZeros64(x)/8 + 1 - start
+		}
+		p += 8
+		q += 8
+	}
+	for q < r {
+		if input[p] != input[q] {
+			p++
+			break
+		}
+		p++
+		q++
+	}
+	return p - start
+}
+
+func flzLiterals(runs int, input []byte, src int, output []byte, op int) int {
+	for runs >= MAX_COPY {
+		output[op] = MAX_COPY - 1
+		op++
+		copy(output[op:op+MAX_COPY], input[src:src+MAX_COPY])
+		src += MAX_COPY
+		op += MAX_COPY
+		runs -= MAX_COPY
+	}
+	if runs > 0 {
+		output[op] = byte(runs - 1)
+		op++
+		copy(output[op:op+runs], input[src:src+runs])
+		op += runs
+	}
+	return op
+}
+
+func flz1Match(len int, distance int, output []byte, op int) int {
+	distance--
+	for len > MAX_LEN-2 {
+		output[op] = byte((7 << 5) + (distance >> 8))
+		output[op+1] = MAX_LEN - 2 - 7 - 2
+		output[op+2] = byte(distance & 255)
+		op += 3
+		len -= MAX_LEN - 2
+	}
+	if len < 7 {
+		output[op] = byte((len << 5) + (distance >> 8))
+		output[op+1] = byte(distance & 255)
+		op += 2
+	} else {
+		output[op] = byte((7 << 5) + (distance >> 8))
+		output[op+1] = byte(len - 7)
+		output[op+2] = byte(distance & 255)
+		op += 3
+	}
+	return op
+}
+
+func flz2Match(len int, distance int, output []byte, op int) int {
+	distance--
+	if distance < MAX_DISTANCE2 {
+		if len < 7 {
+			output[op] = byte((len << 5) + (distance >> 8))
+			output[op+1] = byte(distance & 255)
+			op += 2
+		} else {
+			output[op] = byte((7 << 5) + (distance >> 8))
+			op++
+			for len -= 7; len >= 255; len -= 255 {
+				output[op] = 255
+				op++
+			}
+			output[op] = byte(len)
+			output[op+1] = byte(distance & 255)
+			op += 2
+		}
+	} else {
+		/* far away, but not yet in the another galaxy... */
+		distance -= MAX_DISTANCE2
+		if len < 7 {
+			output[op] = byte((len << 5) + 31)
+			op++
+		} else {
+			output[op] = (7 << 5) + 31
+			op++
+			for len -= 7; len >= 255; len -= 255 {
+				output[op] = 255
+				op++
+			}
+			output[op] = byte(len)
+			op++
+		}
+		output[op] = 255
+		output[op+1] = byte(distance >> 8)
+		output[op+2] = byte(distance & 255)
+		op += 3
+	}
+	return op
+}
+
+/*
+Compress a block with fastlz1_compress or fastlz2_compress. Auto picks the
+level the same way fastlz_compress does.
+*/
+func (c *Compressor) compress(level Level, input []byte, length int, output []byte) int {
+	/* start a new generation instead of zeroing the hash table */
+	if uint64(c.base)+uint64(length) > math.MaxUint32 {
+		clear(c.htab[:])
+		c.base = 0
+	}
+
+	var op int
+	if level == Level2 || (level == Auto && length >= 65536) {
+		op = c.flz2Compress(input, length, output)
+	} else {
+		op = c.flz1Compress(input, length, output)
+	}
+
+	c.base += uint32(length)
+	return op
+}
+
+/* hash table entries below base belong to earlier blocks and read as 0 */
+func (c *Compressor) lookup(hash uint32) int {
+	return int(max(c.htab[hash], c.base) - c.base)
+}
+
+func (c *Compressor) flz1Compress(input []byte, length int, output []byte) int {
+	ip := 0
+	ip_bound := length - 4 /* because readU32 */
+	ip_limit := length - 12 - 1
+	op := 0
+
+	var seq, hash uint32
+
+	/* we start with literal copy */
+	anchor := ip
+	ip += 2
+
+	/* main loop */
+	for ip < ip_limit {
+		var ref, distance int
+		var cmp uint32
+
+		/* find potential match */
+		for {
+			seq = flzReadU32(input, ip) & 0xffffff
+			hash = flzHash(seq)
+			ref = c.lookup(hash)
+			c.htab[hash] = c.base + uint32(ip)
+			distance = ip - ref
+			if distance < MAX_DISTANCE1 {
+				cmp = flzReadU32(input, ref) & 0xffffff
+			} else {
+				cmp = 0x1000000
+			}
+			if ip >= ip_limit {
+				break
+			}
+			ip++
+			if seq == cmp {
+				break
+			}
+		}
+
+		if ip >= ip_limit {
+			break
+		}
+		ip--
+
+		if ip > anchor {
+			op = flzLiterals(ip-anchor, input, anchor, output, op)
+		}
+
+		len := flzCmp(input, ref+3, ip+3, ip_bound)
+		op = flz1Match(len, distance, output, op)
+
+		/* update the hash at match boundary */
+		ip += len
+		seq = flzReadU32(input, ip)
+		hash = flzHash(seq & 0xffffff)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+		seq >>= 8
+		hash = flzHash(seq)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+
+		anchor = ip
+	}
+
+	copy := length - anchor
+	op = flzLiterals(copy, input, anchor, output, op)
+
+	return op
+}
+
+/*
+Return the size compress would produce, running the same parse without
+writing any output.
+*/
+func (c *Compressor) compressedLen(level Level, input []byte, length int) int {
+	/* start a new generation instead of zeroing the hash table */
+	if uint64(c.base)+uint64(length) > math.MaxUint32 {
+		clear(c.htab[:])
+		c.base = 0
+	}
+
+	var op int
+	if level == Level2 || (level == Auto && length >= 65536) {
+		op = c.flz2CompressedLen(input, length)
+	} else {
+		op = c.flz1CompressedLen(input, length)
+	}
+
+	c.base += uint32(length)
+	return op
+}
+
+/* flz1Compress without the output */
+func (c *Compressor) flz1CompressedLen(input []byte, length int) int {
+	ip := 0
+	ip_bound := length - 4 /* because readU32 */
+	ip_limit := length - 12 - 1
+	op := 0
+
+	var seq, hash uint32
+
+	/* we start with literal copy */
+	anchor := ip
+	ip += 2
+
+	/* main loop */
+	for ip < ip_limit {
+		var ref, distance int
+		var cmp uint32
+
+		/* find potential match */
+		for {
+			seq = flzReadU32(input, ip) & 0xffffff
+			hash = flzHash(seq)
+			ref = c.lookup(hash)
+			c.htab[hash] = c.base + uint32(ip)
+			distance = ip - ref
+			if distance < MAX_DISTANCE1 {
+				cmp = flzReadU32(input, ref) & 0xffffff
+			} else {
+				cmp = 0x1000000
+			}
+			if ip >= ip_limit {
+				break
+			}
+			ip++
+			if seq == cmp {
+				break
+			}
+		}
+
+		if ip >= ip_limit {
+			break
+		}
+		ip--
+
+		/* literal runs carry one control byte per MAX_COPY bytes */
+		if runs := ip - anchor; runs > 0 {
+			op += runs + (runs+MAX_COPY-1)/MAX_COPY
+		}
+
+		len := flzCmp(input, ref+3, ip+3, ip_bound)
+
+		/* match sizes as written by flz1Match */
+		l := len
+		for l > MAX_LEN-2 {
+			op += 3
+			l -= MAX_LEN - 2
+		}
+		if l < 7 {
+			op += 2
+		} else {
+			op += 3
+		}
+
+		/* update the hash at match boundary */
+		ip += len
+		seq = flzReadU32(input, ip)
+		hash = flzHash(seq & 0xffffff)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+		seq >>= 8
+		hash = flzHash(seq)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+
+		anchor = ip
+	}
+
+	if runs := length - anchor; runs > 0 {
+		op += runs + (runs+MAX_COPY-1)/MAX_COPY
+	}
+
+	return op
+}
+
+func (c *Compressor) flz2Compress(input []byte, length int, output []byte) int {
+	ip := 0
+	ip_bound := length - 4 /* because readU32 */
+	ip_limit := length - 12 - 1
+	op := 0
+
+	var seq, hash uint32
+
+	/* we start with literal copy */
+	anchor := ip
+	ip += 2
+
+	/* main loop */
+	for ip < ip_limit {
+		var ref, distance int
+		var cmp uint32
+
+		/* find potential match */
+		for {
+			seq = flzReadU32(input, ip) & 0xffffff
+			hash = flzHash(seq)
+			ref = c.lookup(hash)
+			c.htab[hash] = c.base + uint32(ip)
+			distance = ip - ref
+			if distance < MAX_FARDISTANCE {
+				cmp = flzReadU32(input, ref) & 0xffffff
+			} else {
+				cmp = 0x1000000
+			}
+			if ip >= ip_limit {
+				break
+			}
+			ip++
+			if seq == cmp {
+				break
+			}
+		}
+
+		if ip >= ip_limit {
+			break
+		}
+		ip--
+
+		/* far, needs at least 5-byte match */
+		if distance >= MAX_DISTANCE2 {
+			if input[ref+3] != input[ip+3] || input[ref+4] != input[ip+4] {
+				ip++
+				continue
+			}
+		}
+
+		if ip > anchor {
+			op = flzLiterals(ip-anchor, input, anchor, output, op)
+		}
+
+		len := flzCmp(input, ref+3, ip+3, ip_bound)
+		op = flz2Match(len, distance, output, op)
+
+		/* update the hash at match boundary */
+		ip += len
+		seq = flzReadU32(input, ip)
+		hash = flzHash(seq & 0xffffff)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+		seq >>= 8
+		hash = flzHash(seq)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+
+		anchor = ip
+	}
+
+	copy := length - anchor
+	op = flzLiterals(copy, input, anchor, output, op)
+
+	/* marker for fastlz2 */
+	if op > 0 {
+		output[0] |= (1 << 5)
+	}
+
+	return op
+}
+
+/* flz2Compress without the output */
+func (c *Compressor) flz2CompressedLen(input []byte, length int) int {
+	ip := 0
+	ip_bound := length - 4 /* because readU32 */
+	ip_limit := length - 12 - 1
+	op := 0
+
+	var seq, hash uint32
+
+	/* we start with literal copy */
+	anchor := ip
+	ip += 2
+
+	/* main loop */
+	for ip < ip_limit {
+		var ref, distance int
+		var cmp uint32
+
+		/* find potential match */
+		for {
+			seq = flzReadU32(input, ip) & 0xffffff
+			hash = flzHash(seq)
+			ref = c.lookup(hash)
+			c.htab[hash] = c.base + uint32(ip)
+			distance = ip - ref
+			if distance < MAX_FARDISTANCE {
+				cmp = flzReadU32(input, ref) & 0xffffff
+			} else {
+				cmp = 0x1000000
+			}
+			if ip >= ip_limit {
+				break
+			}
+			ip++
+			if seq == cmp {
+				break
+			}
+		}
+
+		if ip >= ip_limit {
+			break
+		}
+		ip--
+
+		/* far, needs at least 5-byte match */
+		if distance >= MAX_DISTANCE2 {
+			if input[ref+3] != input[ip+3] || input[ref+4] != input[ip+4] {
+				ip++
+				continue
+			}
+		}
+
+		/* literal runs carry one control byte per MAX_COPY bytes */
+		if runs := ip - anchor; runs > 0 {
+			op += runs + (runs+MAX_COPY-1)/MAX_COPY
+		}
+
+		len := flzCmp(input, ref+3, ip+3, ip_bound)
+
+		/* match sizes as written by flz2Match */
+		op += 2
+		if len >= 7 {
+			op += 1 + (len-7)/255
+		}
+		if distance-1 >= MAX_DISTANCE2 {
+			op += 2 /* 255 then a 16-bit distance, in place of the 8-bit one */
+		}
+
+		/* update the hash at match boundary */
+		ip += len
+		seq = flzReadU32(input, ip)
+		hash = flzHash(seq & 0xffffff)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+		seq >>= 8
+		hash = flzHash(seq)
+		c.htab[hash] = c.base + uint32(ip)
+		ip++
+
+		anchor = ip
+	}
+
+	if runs := length - anchor; runs > 0 {
+		op += runs + (runs+MAX_COPY-1)/MAX_COPY
+	}
+
+	return op
+}
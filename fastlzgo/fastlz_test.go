@@ -1,7 +1,15 @@
 package fastlzgo
 
 import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -17,6 +25,774 @@ func TestEncodeDeoode(t *testing.T) {
 	require.Equal(t, bt, dec)
 }
 
+func TestCompressLevel(t *testing.T) {
+	bt := bytes.Repeat([]byte("hello fastlz level "), 5000)
+	for _, level := range []Level{Auto, Level1, Level2} {
+		enc, err := CompressLevel(bt, level)
+		require.NoError(t, err)
+		require.Less(t, len(enc), len(bt))
+
+		dec := make([]byte, len(bt))
+		size, err := fastlzDecompress(enc, len(enc), dec, len(dec))
+		require.NoError(t, err)
+		require.Equal(t, bt, dec[:size])
+	}
+
+	enc, err := CompressLevel(bt, Level2)
+	require.NoError(t, err)
+	require.Equal(t, byte(1), enc[0]>>5)
+
+	// short inputs are emitted as a single literal run
+	for n := 1; n < 16; n++ {
+		_, err := CompressLevel(bt[:n], Level1)
+		require.NoError(t, err)
+	}
+
+	_, err = CompressLevel(bt, Level(3))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+	_, err = CompressLevel(nil, Level1)
+	require.ErrorIs(t, err, ErrEmptyInput)
+}
+
+func TestCompressLegacy(t *testing.T) {
+	bt := bytes.Repeat([]byte("hello fastlz legacy "), 5000)
+	for _, level := range []Level{Auto, Level1, Level2} {
+		legacy, err := CompressLegacy(bt, level)
+		require.NoError(t, err)
+		enc, err := CompressLevel(bt, level)
+		require.NoError(t, err)
+		require.NotEqual(t, enc, legacy)
+
+		dec, err := Decompress(legacy)
+		require.NoError(t, err)
+		require.Equal(t, bt, dec)
+	}
+
+	_, err := CompressLegacy(bt, Level(3))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+	_, err = CompressLegacy(nil, Level1)
+	require.ErrorIs(t, err, ErrEmptyInput)
+}
+
+func TestDecompressHighRatio(t *testing.T) {
+	for _, size := range []int{2 << 8, 2 << 16, 2 << 20} {
+		bt := make([]byte, size)
+		for _, level := range []Level{Level1, Level2} {
+			enc, err := CompressLevel(bt, level)
+			require.NoError(t, err)
+			require.GreaterOrEqual(t, len(bt)/len(enc), 10)
+
+			dec, err := Decompress(enc)
+			require.NoError(t, err)
+			require.Equal(t, bt, dec)
+
+			dec, err = DecompressSize(enc, len(bt))
+			require.NoError(t, err)
+			require.Equal(t, bt, dec)
+
+			_, err = DecompressSize(enc, len(bt)-1)
+			require.ErrorIs(t, err, ErrOutputTooSmall)
+			_, err = DecompressSize(enc, len(bt)+1)
+			require.ErrorIs(t, err, ErrCorrupt)
+
+			size, err := DecompressedLen(enc)
+			require.NoError(t, err)
+			require.Equal(t, len(bt), size)
+
+			dst := make([]byte, len(bt))
+			n, err := DecompressInto(dst, enc)
+			require.NoError(t, err)
+			require.Equal(t, bt, dst[:n])
+
+			_, err = DecompressInto(dst[:len(bt)-1], enc)
+			require.ErrorIs(t, err, ErrOutputTooSmall)
+		}
+	}
+}
+
+func TestDecompressErrors(t *testing.T) {
+	enc, err := Compress([]byte("hello hello hello hello hello"))
+	require.NoError(t, err)
+
+	_, err = Decompress(nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+
+	// unknown level bits in the first byte
+	bad := append([]byte{}, enc...)
+	bad[0] |= 2 << 5
+	_, err = Decompress(bad)
+	var cerr *CorruptError
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, TokenHeader, cerr.Kind)
+	require.Equal(t, 0, cerr.Offset)
+
+	// literal run longer than the input
+	_, err = Decompress(enc[:4])
+	require.ErrorIs(t, err, ErrCorrupt)
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, TokenLiteral, cerr.Kind)
+
+	// match reaching before the start of the output
+	_, err = Decompress([]byte{0, 'a', 1<<5 | 1, 0})
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, TokenMatch, cerr.Kind)
+	require.Equal(t, 2, cerr.Offset)
+}
+
+func TestAppend(t *testing.T) {
+	bt := bytes.Repeat([]byte("hello fastlz append "), 5000)
+	enc, err := Compress(bt)
+	require.NoError(t, err)
+
+	prefix := []byte("prefix")
+	out := AppendCompress(prefix, bt)
+	require.Equal(t, prefix, out[:len(prefix)])
+	require.Equal(t, enc, out[len(prefix):])
+	require.Equal(t, prefix, AppendCompress(prefix, nil))
+
+	dst := make([]byte, CompressBound(len(bt)))
+	n, err := CompressInto(dst, bt)
+	require.NoError(t, err)
+	require.Equal(t, enc, dst[:n])
+	_, err = CompressInto(dst[:len(enc)], bt)
+	require.ErrorIs(t, err, ErrOutputTooSmall)
+	_, err = CompressInto(dst, nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+
+	dec, err := AppendDecompress(prefix, enc)
+	require.NoError(t, err)
+	require.Equal(t, prefix, dec[:len(prefix)])
+	require.Equal(t, bt, dec[len(prefix):])
+	_, err = AppendDecompress(nil, nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+
+	// no garbage once the buffers are large enough
+	cbuf := make([]byte, 0, CompressBound(len(bt)))
+	dbuf := make([]byte, 0, len(bt))
+	allocs := testing.AllocsPerRun(10, func() {
+		cbuf = AppendCompress(cbuf[:0], bt)
+		dbuf, err = AppendDecompress(dbuf[:0], cbuf)
+		if _, err := CompressInto(dst, bt); err != nil {
+			panic(err)
+		}
+		if _, err := DecompressInto(dbuf, cbuf); err != nil {
+			panic(err)
+		}
+	})
+	require.NoError(t, err)
+	require.Zero(t, allocs)
+}
+
+func TestCompressor(t *testing.T) {
+	inputs := [][]byte{
+		bytes.Repeat([]byte("hello compressor "), 5000),
+		[]byte("hello hello hello hello hello hello"),
+		make([]byte, 2<<16),
+		bytes.Repeat([]byte("0123456789abcdef"), 600),
+	}
+	for _, level := range []Level{Auto, Level1, Level2} {
+		c, err := NewCompressor(level)
+		require.NoError(t, err)
+		for i := 0; i < 3; i++ {
+			for _, input := range inputs {
+				fresh, err := NewCompressor(level)
+				require.NoError(t, err)
+				want, err := fresh.Compress(input)
+				require.NoError(t, err)
+
+				enc, err := c.Compress(input)
+				require.NoError(t, err)
+				require.Equal(t, want, enc)
+				require.Equal(t, want, c.AppendCompress(nil, input))
+			}
+		}
+
+		// the table is cleared when the base would overflow
+		c.base = math.MaxUint32 - 100
+		enc, err := c.Compress(inputs[0])
+		require.NoError(t, err)
+		want, err := CompressLevel(inputs[0], level)
+		require.NoError(t, err)
+		require.Equal(t, want, enc)
+	}
+
+	_, err := NewCompressor(Level(3))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+
+	var c Compressor
+	_, err = c.CompressInto(make([]byte, 10), inputs[0])
+	require.ErrorIs(t, err, ErrOutputTooSmall)
+}
+
+func BenchmarkCompressor(b *testing.B) {
+	bt := make([]byte, 2<<8)
+	dst := make([]byte, CompressBound(len(bt)))
+
+	b.Run("new table [Length 2<<8]", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(bt)))
+		for i := 0; i < b.N; i++ {
+			c := new(Compressor)
+			_, err := c.CompressInto(dst, bt)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("reused [Length 2<<8]", func(b *testing.B) {
+		c := new(Compressor)
+		b.ReportAllocs()
+		b.SetBytes(int64(len(bt)))
+		for i := 0; i < b.N; i++ {
+			_, err := c.CompressInto(dst, bt)
+			require.NoError(b, err)
+		}
+	})
+
+	b.Run("pooled [Length 2<<8]", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(bt)))
+		for i := 0; i < b.N; i++ {
+			_, err := CompressInto(dst, bt)
+			require.NoError(b, err)
+		}
+	})
+}
+
+func TestCompressedLen(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	far := make([]byte, 3<<16)
+	rnd.Read(far[:1<<16])
+	copy(far[2<<16:], far[:1<<16]) // matches beyond the level 2 near distance
+
+	inputs := [][]byte{
+		nil,
+		[]byte("h"),
+		[]byte("hello hello hello hello hello hello"),
+		bytes.Repeat([]byte("hello compressed len "), 5000),
+		make([]byte, 2<<16),
+		bytes.Repeat([]byte{0xa9, 0x05, 0x9c, 0xbb, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 12),
+		far,
+	}
+	for _, input := range inputs {
+		want := 0
+		if len(input) > 0 {
+			enc, err := Compress(input)
+			require.NoError(t, err)
+			want = len(enc)
+		}
+		require.Equal(t, want, CompressedLen(input))
+
+		for _, level := range []Level{Auto, Level1, Level2} {
+			want := 0
+			if len(input) > 0 {
+				enc, err := CompressLevel(input, level)
+				require.NoError(t, err)
+				want = len(enc)
+			}
+			size, err := CompressedLenLevel(input, level)
+			require.NoError(t, err)
+			require.Equal(t, want, size, "length %d level %d", len(input), level)
+		}
+	}
+
+	_, err := CompressedLenLevel(inputs[2], Level(3))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+}
+
+func TestCompressCost(t *testing.T) {
+	// The calls are synthetic, ABI-encoded with real selectors and addresses
+	// but not taken from real transactions, so the gas saved is indicative.
+	calls := readCalldata(t)
+	gas := func(b []byte) uint64 {
+		var total uint64
+		for _, c := range b {
+			total += CalldataCost(c)
+		}
+		return total
+	}
+
+	var totalGreedy, totalLegacy, totalCost uint64
+	for _, call := range calls {
+		enc, err := CompressCost(call, CalldataCost)
+		require.NoError(t, err)
+		require.Equal(t, byte(0), enc[0]>>5)
+		dec, err := Decompress(enc)
+		require.NoError(t, err)
+		require.Equal(t, call, dec)
+
+		greedy, err := CompressLevel(call, Level1)
+		require.NoError(t, err)
+		legacy, err := CompressLegacy(call, Level1)
+		require.NoError(t, err)
+		require.LessOrEqual(t, gas(enc), gas(greedy))
+		require.LessOrEqual(t, gas(enc), gas(legacy))
+
+		totalGreedy += gas(greedy)
+		totalLegacy += gas(legacy)
+		totalCost += gas(enc)
+	}
+	t.Logf("calldata gas of %d synthetic calls: level 1 %d, legacy level 1 %d, cost-aware %d (%d saved)",
+		len(calls), totalGreedy, totalLegacy, totalCost, totalGreedy-totalCost)
+
+	// long runs, far matches and literal-only inputs still round trip
+	for _, bt := range [][]byte{
+		[]byte("a"),
+		make([]byte, 3),
+		make([]byte, 100000),
+		bytes.Repeat([]byte("hello fastlz cost "), 2000),
+		[]byte("no repeats here"),
+		brokenRuns(1 << 18),
+	} {
+		enc, err := CompressCost(bt, CalldataCost)
+		require.NoError(t, err)
+		dec, err := Decompress(enc)
+		require.NoError(t, err)
+		require.Equal(t, bt, dec)
+	}
+
+	_, err := CompressCost(nil, CalldataCost)
+	require.ErrorIs(t, err, ErrEmptyInput)
+}
+
+// brokenRuns returns runs of 'a' broken every 251 bytes, which match at
+// every distance of the hash chain without reaching the longest match.
+func brokenRuns(n int) []byte {
+	b := bytes.Repeat([]byte("a"), n)
+	for i := 250; i < n; i += 251 {
+		b[i] = byte(i / 251)
+	}
+	return b
+}
+
+// readCalldata reads the hex calls in testdata/calldata.txt.
+func readCalldata(t testing.TB) [][]byte {
+	data, err := os.ReadFile("testdata/calldata.txt")
+	require.NoError(t, err)
+
+	var calls [][]byte
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		call, err := hex.DecodeString(strings.TrimPrefix(line, "0x"))
+		require.NoError(t, err)
+		calls = append(calls, call)
+	}
+	return calls
+}
+
+func BenchmarkCompressCost(b *testing.B) {
+	calls := readCalldata(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, call := range calls {
+			CompressCost(call, CalldataCost)
+		}
+	}
+}
+
+func BenchmarkCompressedLen(b *testing.B) {
+	bt := bytes.Repeat([]byte{0xa9, 0x05, 0x9c, 0xbb, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3}, 32)
+
+	b.Run("CompressedLen [Length 2<<8]", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(bt)))
+		for i := 0; i < b.N; i++ {
+			_ = CompressedLen(bt)
+		}
+	})
+
+	b.Run("len(Compress) [Length 2<<8]", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(bt)))
+		for i := 0; i < b.N; i++ {
+			enc, err := Compress(bt)
+			require.NoError(b, err)
+			_ = len(enc)
+		}
+	})
+}
+
+func BenchmarkAppendCompress(b *testing.B) {
+	bt := make([]byte, 2<<16)
+	dst := make([]byte, 0, CompressBound(len(bt)))
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bt)))
+	for i := 0; i < b.N; i++ {
+		dst = AppendCompress(dst[:0], bt)
+	}
+}
+
+func TestStream(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	random := make([]byte, 3*MinBlockSize+17)
+	rnd.Read(random)
+	text := bytes.Repeat([]byte("hello fastlz stream "), 20000)
+
+	for _, input := range [][]byte{nil, []byte("a"), random, text} {
+		for _, opts := range [][]WriterOption{
+			nil,
+			{WithLevel(Level1), WithChecksum(false)},
+			{WithLevel(Level2), WithBlockSize(MinBlockSize)},
+			{WithBlockSize(MaxBlockSize)},
+		} {
+			var buf bytes.Buffer
+			w, err := NewWriter(&buf, opts...)
+			require.NoError(t, err)
+			// uneven writes exercise the buffering
+			for p := input; len(p) > 0; {
+				n := min(len(p), 1+rnd.Intn(3*MinBlockSize))
+				_, err := w.Write(p[:n])
+				require.NoError(t, err)
+				p = p[n:]
+			}
+			require.NoError(t, w.Close())
+			require.NoError(t, w.Close())
+			_, err = w.Write([]byte("x"))
+			require.ErrorIs(t, err, ErrClosed)
+
+			dec, err := io.ReadAll(NewReader(bytes.NewReader(buf.Bytes())))
+			require.NoError(t, err)
+			require.Equal(t, len(input), len(dec))
+			require.True(t, bytes.Equal(input, dec))
+
+			var out bytes.Buffer
+			n, err := NewReader(bytes.NewReader(buf.Bytes())).WriteTo(&out)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(input)), n)
+			require.True(t, bytes.Equal(input, out.Bytes()))
+		}
+	}
+
+	// flushed data is readable before Close
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.Zero(t, buf.Len())
+	require.NoError(t, w.Flush())
+	r := NewReader(&buf)
+	p := make([]byte, 16)
+	n, err := r.Read(p)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(p[:n]))
+
+	// Reset starts a new stream
+	var buf2 bytes.Buffer
+	w.Reset(&buf2)
+	_, err = w.Write(text)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	r.Reset(bytes.NewReader(buf2.Bytes()))
+	dec, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(text, dec))
+
+	_, err = NewWriter(&buf, WithBlockSize(MinBlockSize-1))
+	require.Error(t, err)
+	_, err = NewWriter(&buf, WithLevel(Level(3)))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+}
+
+func TestStreamErrors(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(t, err)
+	_, err = w.Write(bytes.Repeat([]byte("hello fastlz stream "), 100))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	stream := buf.Bytes()
+
+	read := func(stream []byte) error {
+		_, err := io.ReadAll(NewReader(bytes.NewReader(stream)))
+		return err
+	}
+
+	bad := bytes.Clone(stream)
+	bad[len(bad)-5] ^= 1
+	require.Error(t, read(bad))
+
+	bad = bytes.Clone(stream)
+	bad[frameHeaderSize+8] ^= 1 // checksum
+	require.ErrorIs(t, read(bad), ErrChecksum)
+
+	bad = bytes.Clone(stream)
+	bad[0] = 'X'
+	require.ErrorIs(t, read(bad), ErrCorrupt)
+
+	bad = bytes.Clone(stream)
+	bad[4] = 2
+	require.ErrorIs(t, read(bad), ErrCorrupt)
+
+	// the end marker is required
+	for _, n := range []int{0, 5, frameHeaderSize, len(stream) - 4, len(stream) - 1} {
+		require.ErrorIs(t, read(stream[:n]), io.ErrUnexpectedEOF)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	input := make([]byte, 40*MinBlockSize+123)
+	for i := range input {
+		input[i] = byte(rnd.Intn(4)) + 'a'
+	}
+	rnd.Read(input[:2*MinBlockSize]) // stored blocks
+
+	for _, opts := range [][]WriterOption{
+		{WithBlockSize(MinBlockSize)},
+		{WithBlockSize(3 * MinBlockSize), WithLevel(Level2), WithChecksum(false)},
+	} {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, opts...)
+		require.NoError(t, err)
+		_, err = w.Write(input)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+
+		for _, n := range []int{0, 1, 2, 7, 100} {
+			enc, err := CompressParallel(input, append(opts, WithConcurrency(n))...)
+			require.NoError(t, err)
+			require.Equal(t, buf.Bytes(), enc)
+
+			dec, err := DecompressParallel(enc, n)
+			require.NoError(t, err)
+			require.True(t, bytes.Equal(input, dec))
+		}
+	}
+
+	enc, err := CompressParallel(nil)
+	require.NoError(t, err)
+	dec, err := DecompressParallel(enc, 4)
+	require.NoError(t, err)
+	require.Empty(t, dec)
+
+	enc, err = CompressParallel(input, WithBlockSize(MinBlockSize))
+	require.NoError(t, err)
+	bad := bytes.Clone(enc)
+	bad[len(bad)-10] ^= 1
+	_, err = DecompressParallel(bad, 4)
+	require.ErrorIs(t, err, ErrChecksum)
+	_, err = DecompressParallel(enc[:len(enc)-1], 4)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	_, err = DecompressParallel(enc[:5], 4)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// one-byte blocks claiming the largest block size are rejected before
+	// their claimed sizes are allocated
+	bomb := appendFrameHeader(nil, MaxBlockSize, false, false)
+	for i := 0; i < 4096; i++ {
+		bomb = binary.LittleEndian.AppendUint32(bomb, 1)
+		bomb = binary.LittleEndian.AppendUint32(bomb, MaxBlockSize)
+		bomb = append(bomb, 0)
+	}
+	bomb = binary.LittleEndian.AppendUint32(bomb, 0)
+	require.Len(t, bomb, 36878)
+	_, err = DecompressParallel(bomb, 1)
+	require.ErrorIs(t, err, ErrCorrupt)
+	_, err = io.ReadAll(NewReader(bytes.NewReader(bomb)))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	// the largest expansion the format allows is accepted
+	zeros := make([]byte, MaxBlockSize)
+	enc, err = CompressParallel(zeros, WithBlockSize(MaxBlockSize), WithLevel(Level2))
+	require.NoError(t, err)
+	dec, err = DecompressParallel(enc, 1)
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(zeros, dec))
+}
+
+func TestSeekable(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	input := make([]byte, 20*MinBlockSize+123)
+	for i := range input {
+		input[i] = byte(rnd.Intn(4)) + 'a'
+	}
+	rnd.Read(input[5*MinBlockSize : 6*MinBlockSize]) // a stored block
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, WithBlockSize(MinBlockSize), WithSeekable(true))
+	require.NoError(t, err)
+	_, err = w.Write(input[:1000])
+	require.NoError(t, err)
+	require.NoError(t, w.Flush()) // a short block in the middle
+	_, err = w.Write(input[1000:])
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	stream := buf.Bytes()
+
+	enc, err := CompressParallel(input, WithBlockSize(MinBlockSize), WithSeekable(true))
+	require.NoError(t, err)
+
+	for _, stream := range [][]byte{stream, enc} {
+		// the index is invisible to the sequential readers
+		dec, err := io.ReadAll(NewReader(bytes.NewReader(stream)))
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(input, dec))
+		dec, err = DecompressParallel(stream, 2)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(input, dec))
+
+		s, err := NewSeekableReader(bytes.NewReader(stream), int64(len(stream)))
+		require.NoError(t, err)
+		require.Equal(t, int64(len(input)), s.Size())
+		for i := 0; i < 200; i++ {
+			off := rnd.Intn(len(input))
+			p := make([]byte, rnd.Intn(3*MinBlockSize))
+			n, err := s.ReadAt(p, int64(off))
+			if off+len(p) > len(input) {
+				require.ErrorIs(t, err, io.EOF)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, input[off:off+n], p[:n])
+		}
+
+		pos, err := s.Seek(-100, io.SeekEnd)
+		require.NoError(t, err)
+		require.Equal(t, int64(len(input)-100), pos)
+		rest, err := io.ReadAll(s)
+		require.NoError(t, err)
+		require.Equal(t, input[len(input)-100:], rest)
+		_, err = s.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		all, err := io.ReadAll(s)
+		require.NoError(t, err)
+		require.True(t, bytes.Equal(input, all))
+	}
+
+	enc, err = CompressParallel(nil, WithSeekable(true))
+	require.NoError(t, err)
+	s, err := NewSeekableReader(bytes.NewReader(enc), int64(len(enc)))
+	require.NoError(t, err)
+	require.Zero(t, s.Size())
+
+	enc, err = CompressParallel(input)
+	require.NoError(t, err)
+	_, err = NewSeekableReader(bytes.NewReader(enc), int64(len(enc)))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	bad := bytes.Clone(stream)
+	bad[len(bad)-seekFooterSize-6] ^= 1 // original offset of the last block
+	_, err = NewSeekableReader(bytes.NewReader(bad), int64(len(bad)))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	bad = bytes.Clone(stream)
+	bad[len(bad)-seekFooterSize-16] ^= 1 // stream offset of the last block
+	s, err = NewSeekableReader(bytes.NewReader(bad), int64(len(bad)))
+	require.NoError(t, err)
+	_, err = s.ReadAt(make([]byte, 1), s.Size()-1)
+	require.ErrorIs(t, err, ErrCorrupt)
+	_, err = NewSeekableReader(bytes.NewReader(stream[:len(stream)-1]), int64(len(stream)-1))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	// a gap of 1 GiB before the end marker is not read into memory
+	count := int(binary.LittleEndian.Uint32(stream[len(stream)-8:]))
+	end := len(stream) - seekFooterSize - count*16 - 4
+	gapped := &gapReader{head: stream[:end], gap: 1 << 30, tail: stream[end:]}
+	s, err = NewSeekableReader(gapped, gapped.size())
+	require.NoError(t, err)
+	_, err = s.ReadAt(make([]byte, 1), s.Size()-1)
+	require.ErrorIs(t, err, ErrCorrupt)
+	require.LessOrEqual(t, gapped.maxRead, 3*MinBlockSize)
+}
+
+// gapReader is a ReaderAt over head, gap zero bytes and tail, recording the
+// longest read.
+type gapReader struct {
+	head    []byte
+	gap     int64
+	tail    []byte
+	maxRead int
+}
+
+func (g *gapReader) size() int64 {
+	return int64(len(g.head)) + g.gap + int64(len(g.tail))
+}
+
+func (g *gapReader) ReadAt(p []byte, off int64) (int, error) {
+	g.maxRead = max(g.maxRead, len(p))
+	for i := range p {
+		switch o := off + int64(i); {
+		case o < int64(len(g.head)):
+			p[i] = g.head[o]
+		case o < int64(len(g.head))+g.gap:
+			p[i] = 0
+		case o < g.size():
+			p[i] = g.tail[o-int64(len(g.head))-g.gap]
+		default:
+			return i, io.EOF
+		}
+	}
+	return len(p), nil
+}
+
+func BenchmarkCompressParallel(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	bt := make([]byte, 2<<24)
+	for i := range bt {
+		bt[i] = byte(rnd.Intn(16))
+	}
+
+	b.Run("Serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			_, err := Compress(bt)
+			require.NoError(b, err)
+		}
+		b.SetBytes(int64(len(bt)))
+	})
+
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("Workers %d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := CompressParallel(bt, WithConcurrency(n))
+				require.NoError(b, err)
+			}
+			b.SetBytes(int64(len(bt)))
+		})
+	}
+
+	enc, err := CompressParallel(bt)
+	require.NoError(b, err)
+	for _, n := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("Decompress workers %d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, err := DecompressParallel(enc, n)
+				require.NoError(b, err)
+			}
+			b.SetBytes(int64(len(bt)))
+		})
+	}
+}
+
+func BenchmarkStream(b *testing.B) {
+	bt := bytes.Repeat([]byte("hello fastlz stream "), 1<<16)
+	b.Run("Writer", func(b *testing.B) {
+		w, err := NewWriter(io.Discard)
+		require.NoError(b, err)
+		for i := 0; i < b.N; i++ {
+			w.Reset(io.Discard)
+			w.Write(bt)
+			w.Close()
+		}
+		b.SetBytes(int64(len(bt)))
+	})
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	require.NoError(b, err)
+	w.Write(bt)
+	w.Close()
+	b.Run("Reader", func(b *testing.B) {
+		r := NewReader(nil)
+		for i := 0; i < b.N; i++ {
+			r.Reset(bytes.NewReader(buf.Bytes()))
+			r.WriteTo(io.Discard)
+		}
+		b.SetBytes(int64(len(bt)))
+	})
+}
+
 func BenchmarkCompress(b *testing.B) {
 	b.Run("Length 2<<8", func(b *testing.B) {
 		bt := make([]byte, 2<<8)
@@ -45,3 +821,442 @@ func BenchmarkCompress(b *testing.B) {
 		b.SetBytes(int64(len(bt)))
 	})
 }
+
+func TestPrefixed(t *testing.T) {
+	calldata, err := os.ReadFile("testdata/calldata.txt")
+	require.NoError(t, err)
+	var seq []byte
+	for i := 1; i <= 20000; i++ {
+		seq = fmt.Appendf(seq, "%d\n", i)
+	}
+
+	for _, input := range [][]byte{{}, []byte("hello, prefixed\n"), calldata, seq} {
+		enc, err := CompressPrefixed(input, Auto)
+		require.NoError(t, err)
+		require.Equal(t, uint32(len(input)), binary.LittleEndian.Uint32(enc))
+		if len(input) == 0 {
+			require.Len(t, enc, prefixLen)
+		} else {
+			legacy, err := CompressLegacy(input, Auto)
+			require.NoError(t, err)
+			require.Equal(t, legacy, enc[prefixLen:])
+		}
+
+		dec, err := DecompressPrefixed(enc)
+		require.NoError(t, err)
+		require.Equal(t, input, dec)
+	}
+
+	input := bytes.Repeat([]byte("prefixed "), 1000)
+	for _, level := range []Level{Level1, Level2} {
+		enc, err := CompressPrefixed(input, level)
+		require.NoError(t, err)
+		require.Equal(t, byte(level-1), enc[4]>>5)
+		dec, err := DecompressPrefixed(enc)
+		require.NoError(t, err)
+		require.Equal(t, input, dec)
+	}
+	_, err = CompressPrefixed(input, Level(3))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+
+	enc, err := CompressPrefixed(input, Auto)
+	require.NoError(t, err)
+	for _, tc := range []struct {
+		name  string
+		input []byte
+	}{
+		{"short prefix", enc[:3]},
+		{"no block", enc[:4]},
+		{"larger prefix", append([]byte{0x29, 0x23, 0, 0}, enc[4:]...)},
+		{"smaller prefix", append([]byte{0x27, 0x23, 0, 0}, enc[4:]...)},
+		{"huge prefix", append([]byte{0xff, 0xff, 0xff, 0xff}, enc[4:]...)},
+		{"data after empty", append([]byte{0, 0, 0, 0}, enc[4:]...)},
+		{"truncated block", enc[:len(enc)-1]},
+	} {
+		_, err := DecompressPrefixed(tc.input)
+		require.ErrorIs(t, err, ErrCorrupt, tc.name)
+	}
+	_, err = DecompressPrefixed(nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+}
+
+func TestBlock(t *testing.T) {
+	input := bytes.Repeat([]byte("hello fastlz block "), 5000)
+	for _, level := range []Level{Auto, Level1, Level2} {
+		enc, err := EncodeBlock(nil, input, level)
+		require.NoError(t, err)
+		raw, err := CompressLevel(input, level)
+		require.NoError(t, err)
+		require.Equal(t, []byte{0x98, 0xe6, 0x05}, enc[:3]) // uvarint 95000
+		require.Equal(t, raw, enc[3:])
+
+		n, err := DecodedLen(enc)
+		require.NoError(t, err)
+		require.Equal(t, len(input), n)
+
+		dec, err := DecodeBlock(nil, enc)
+		require.NoError(t, err)
+		require.Equal(t, input, dec)
+	}
+
+	// dst is reused when it is large enough
+	buf := make([]byte, 0, CompressBound(len(input))+3)
+	enc, err := EncodeBlock(buf, input, Level1)
+	require.NoError(t, err)
+	require.Same(t, &buf[:1][0], &enc[0])
+	out := make([]byte, len(input))
+	dec, err := DecodeBlock(out, enc)
+	require.NoError(t, err)
+	require.Same(t, &out[0], &dec[0])
+
+	empty, err := EncodeBlock(nil, nil, Level1)
+	require.NoError(t, err)
+	require.Equal(t, []byte{0}, empty)
+	dec, err = DecodeBlock(nil, empty)
+	require.NoError(t, err)
+	require.Empty(t, dec)
+
+	_, err = EncodeBlock(nil, input, Level(3))
+	require.ErrorIs(t, err, ErrUnknownLevel)
+	_, err = DecodeBlock(nil, nil)
+	require.ErrorIs(t, err, ErrEmptyInput)
+	for _, tc := range []struct {
+		name  string
+		input []byte
+	}{
+		{"bad uvarint", []byte{0x80, 0x80}},
+		{"too long", []byte{0xff, 0xff, 0xff, 0xff, 0x0f, 0}},
+		{"no block", enc[:3]},
+		{"larger length", append([]byte{0x99, 0xe6, 0x05}, enc[3:]...)},
+		{"smaller length", append([]byte{0x97, 0xe6, 0x05}, enc[3:]...)},
+		{"data after empty", append([]byte{0}, enc[3:]...)},
+		{"truncated block", enc[:len(enc)-1]},
+	} {
+		_, err := DecodeBlock(nil, tc.input)
+		require.ErrorIs(t, err, ErrCorrupt, tc.name)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	input := bytes.Repeat([]byte("hello fastlz validate "), 5000)
+	for _, level := range []Level{Level1, Level2} {
+		enc, err := CompressLevel(input, level)
+		require.NoError(t, err)
+		require.NoError(t, Validate(enc))
+		n, err := DecompressedLen(enc)
+		require.NoError(t, err)
+		require.Equal(t, len(input), n)
+	}
+
+	var cerr *CorruptError
+	for _, tc := range []struct {
+		name   string
+		input  []byte
+		kind   TokenKind
+		offset int
+	}{
+		{"level 3", []byte{2 << 5, 'a'}, TokenHeader, 0},
+		{"truncated literal", []byte{0, 'a', 3, 'b'}, TokenLiteral, 2},
+		{"match before start", []byte{0, 'a', 1<<5 | 1, 0}, TokenMatch, 2},
+		{"truncated match", []byte{0, 'a', 7 << 5}, TokenMatch, 2},
+		{"far match before start", []byte{1 << 5, 'a', 1<<5 | 31, 255, 0, 0}, TokenFarMatch, 2},
+	} {
+		err := Validate(tc.input)
+		require.ErrorAs(t, err, &cerr, tc.name)
+		require.Equal(t, tc.kind, cerr.Kind, tc.name)
+		require.Equal(t, tc.offset, cerr.Offset, tc.name)
+	}
+	require.ErrorIs(t, Validate(nil), ErrEmptyInput)
+
+	// Validate accepts exactly the blocks the decoders accept
+	rnd := rand.New(rand.NewSource(1))
+	out := make([]byte, 1<<20)
+	for i := 0; i < 100000; i++ {
+		block := make([]byte, 1+rnd.Intn(16))
+		rnd.Read(block)
+		block[0] &= 1<<6 - 1 // mostly level 1 and 2
+		n, err := DecompressedLen(block)
+		m, derr := DecompressInto(out, block)
+		require.Equal(t, derr == nil, err == nil, "%x", block)
+		require.Equal(t, m, n, "%x", block)
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	// a literal and a level 2 match of about a megabyte at distance 1
+	bomb := []byte{1 << 5, 'a', 7 << 5}
+	bomb = append(bomb, bytes.Repeat([]byte{255}, 4000)...)
+	bomb = append(bomb, 0, 0)
+	size, err := DecompressedLen(bomb)
+	require.NoError(t, err)
+	require.Equal(t, 1+6+255*4000+3, size)
+
+	dec, err := DecompressLimit(bomb, size)
+	require.NoError(t, err)
+	require.Equal(t, bytes.Repeat([]byte{'a'}, size), dec)
+	_, err = DecompressLimit(bomb, size-1)
+	require.ErrorIs(t, err, ErrTooLarge)
+	allocs := testing.AllocsPerRun(10, func() {
+		if _, err := DecompressLimit(bomb, 1<<16); err != ErrTooLarge {
+			panic(err)
+		}
+	})
+	require.Zero(t, allocs)
+
+	n, err := DecompressedLenLimit(bomb, size)
+	require.NoError(t, err)
+	require.Equal(t, size, n)
+	_, err = DecompressedLenLimit(bomb, size-1)
+	require.ErrorIs(t, err, ErrTooLarge)
+
+	// sizes given by the caller or a header are checked before allocating
+	block, err := EncodeBlock(nil, dec, Level2)
+	require.NoError(t, err)
+	prefixed := binary.LittleEndian.AppendUint32(nil, uint32(size))
+	prefixed = append(prefixed, bomb...)
+	allocs = testing.AllocsPerRun(10, func() {
+		if _, err := DecodeBlockLimit(nil, block, size-1); err != ErrTooLarge {
+			panic(err)
+		}
+		if _, err := DecompressPrefixedLimit(prefixed, size-1); err != ErrTooLarge {
+			panic(err)
+		}
+	})
+	require.Zero(t, allocs)
+	_, err = DecompressSize(bomb, math.MaxInt>>1) // would not fit in memory
+	require.ErrorIs(t, err, ErrCorrupt)
+	dec, err = DecodeBlockLimit(nil, block, size)
+	require.NoError(t, err)
+	require.Len(t, dec, size)
+	dec, err = DecompressPrefixedLimit(prefixed, size)
+	require.NoError(t, err)
+	require.Len(t, dec, size)
+
+	// a header declaring less than the block holds stops the walk early
+	bad := binary.LittleEndian.AppendUint32(nil, 10)
+	_, err = DecompressPrefixed(append(bad, bomb...))
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	_, err = DecompressLimit(nil, 1)
+	require.ErrorIs(t, err, ErrEmptyInput)
+	_, err = DecompressLimit([]byte{0, 'a', 1<<5 | 1, 0}, 100)
+	require.ErrorIs(t, err, ErrCorrupt)
+
+	// the stream limit covers all the blocks
+	input := bytes.Repeat([]byte("hello fastlz limit "), 10*MinBlockSize/19)
+	stream, err := CompressParallel(input, WithBlockSize(MinBlockSize), WithSeekable(true))
+	require.NoError(t, err)
+	for _, limit := range []int64{int64(len(input)), int64(len(input)) - 1, MinBlockSize} {
+		wantErr := limit < int64(len(input))
+
+		dec, err := io.ReadAll(NewReader(bytes.NewReader(stream), WithMaxDecodedSize(limit)))
+		if wantErr {
+			require.ErrorIs(t, err, ErrTooLarge)
+			require.LessOrEqual(t, int64(len(dec)), limit)
+		} else {
+			require.NoError(t, err)
+			require.Equal(t, input, dec)
+		}
+
+		_, err = DecompressParallel(stream, 0, WithMaxDecodedSize(limit))
+		_, serr := NewSeekableReader(bytes.NewReader(stream), int64(len(stream)), WithMaxDecodedSize(limit))
+		if wantErr {
+			require.ErrorIs(t, err, ErrTooLarge)
+			require.ErrorIs(t, serr, ErrTooLarge)
+		} else {
+			require.NoError(t, err)
+			require.NoError(t, serr)
+		}
+	}
+}
+
+// applyTokens rebuilds the decompressed data of a block from its tokens.
+func applyTokens(t testing.TB, block []byte) ([]Token, []byte, error) {
+	var tokens []Token
+	var out []byte
+	r := NewTokenReader(block)
+	for {
+		tok, err := r.Next()
+		if err == io.EOF {
+			require.Equal(t, len(out), r.Decoded())
+			return tokens, out, nil
+		}
+		if err != nil {
+			return tokens, out, err
+		}
+		tokens = append(tokens, tok)
+		switch tok.Kind {
+		case TokenLiteral:
+			out = append(out, tok.Literal...)
+		case TokenMatch, TokenFarMatch:
+			for i := 0; i < tok.Length; i++ {
+				out = append(out, out[len(out)-tok.Distance])
+			}
+		}
+	}
+}
+
+func TestTokenReader(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	chunk := make([]byte, 3000)
+	rnd.Read(chunk)
+	input := bytes.Repeat(chunk, 2)
+	input = append(input, bytes.Repeat([]byte{'z'}, 1000)...)
+	input = append(input, make([]byte, 10000)...)
+	input = append(input, chunk...) // 14000 bytes back, a far match at level 2
+
+	for _, level := range []Level{Level1, Level2} {
+		enc, err := CompressLevel(input, level)
+		require.NoError(t, err)
+		tokens, out, err := applyTokens(t, enc)
+		require.NoError(t, err)
+		require.Equal(t, input, out)
+
+		require.Equal(t, Token{Kind: TokenHeader, Level: level}, tokens[0])
+		require.Equal(t, TokenLiteral, tokens[1].Kind)
+		require.Equal(t, 0, tokens[1].Offset)
+		kinds := map[TokenKind]int{}
+		for _, tok := range tokens {
+			kinds[tok.Kind]++
+			require.LessOrEqual(t, tok.Offset, len(enc))
+		}
+		require.Equal(t, 1, kinds[TokenHeader])
+		if level == Level2 {
+			require.NotZero(t, kinds[TokenFarMatch])
+		} else {
+			require.Zero(t, kinds[TokenFarMatch])
+		}
+	}
+
+	var cerr *CorruptError
+	_, _, err := applyTokens(t, []byte{2 << 5, 'a'})
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, TokenHeader, cerr.Kind)
+	r := NewTokenReader([]byte{0, 'a', 1<<5 | 1, 0})
+	for i := 0; i < 2; i++ {
+		_, err = r.Next()
+		require.NoError(t, err)
+	}
+	_, err = r.Next()
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, 2, cerr.Offset)
+	_, err = r.Next()
+	require.Equal(t, cerr, err)
+	_, err = NewTokenReader(nil).Next()
+	require.ErrorIs(t, err, ErrEmptyInput)
+
+	// the tokens accept exactly the blocks the decoders accept
+	for i := 0; i < 100000; i++ {
+		block := make([]byte, 1+rnd.Intn(16))
+		rnd.Read(block)
+		block[0] &= 1<<6 - 1
+		dec, derr := Decompress(block)
+		_, out, err := applyTokens(t, block)
+		require.Equal(t, derr == nil, err == nil, "%x", block)
+		if err == nil {
+			require.Equal(t, dec, out, "%x", block)
+		}
+	}
+}
+
+func TestBlockWriter(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	chunk := make([]byte, 3000)
+	rnd.Read(chunk)
+	input := bytes.Repeat(chunk, 2)
+	input = append(input, bytes.Repeat([]byte{'z'}, 1000)...)
+	input = append(input, make([]byte, 10000)...)
+	input = append(input, chunk...)
+
+	// writing the tokens of a block back gives the same block
+	for _, level := range []Level{Level1, Level2} {
+		enc, err := CompressLevel(input, level)
+		require.NoError(t, err)
+		w, err := NewBlockWriter(level)
+		require.NoError(t, err)
+		tokens, _, err := applyTokens(t, enc)
+		require.NoError(t, err)
+		for _, tok := range tokens {
+			switch tok.Kind {
+			case TokenLiteral:
+				w.Literal(tok.Literal)
+			case TokenMatch, TokenFarMatch:
+				require.NoError(t, w.Match(tok.Length, tok.Distance))
+			}
+		}
+		require.Equal(t, len(input), w.Len())
+		block, err := w.Finish()
+		require.NoError(t, err)
+		require.Equal(t, enc, block)
+	}
+
+	// hand-written tokens at the limits of the format
+	big := make([]byte, maxFarDistance)
+	rnd.Read(big)
+	for _, level := range []Level{Level1, Level2} {
+		w, err := NewBlockWriter(level)
+		require.NoError(t, err)
+		want := []byte{}
+		literal := func(p []byte) {
+			for len(p) > 0 { // split over calls
+				n := min(len(p), 1+rnd.Intn(50))
+				w.Literal(p[:n])
+				want = append(want, p[:n]...)
+				p = p[n:]
+			}
+		}
+		match := func(length, distance int) {
+			require.NoError(t, w.Match(length, distance))
+			for i := 0; i < length; i++ {
+				want = append(want, want[len(want)-distance])
+			}
+		}
+		literal([]byte("abc"))
+		match(3, 1)
+		match(1000, 3) // split at level 1, escaped at level 2
+		literal(big[:MAX_DISTANCE1])
+		match(8, MAX_DISTANCE1)
+		if level == Level2 {
+			match(9, MAX_DISTANCE2)
+			match(300, MAX_DISTANCE2+1) // the first far distance
+			literal(big)
+			match(4, maxFarDistance)
+		}
+
+		require.ErrorIs(t, w.Match(2, 1), ErrInvalidToken)
+		require.ErrorIs(t, w.Match(3, 0), ErrInvalidToken)
+		require.ErrorIs(t, w.Match(3, map[Level]int{Level1: MAX_DISTANCE1, Level2: maxFarDistance}[level]+1), ErrInvalidToken)
+
+		block, err := w.Finish()
+		require.NoError(t, err)
+		require.Equal(t, byte(level-1), block[0]>>5)
+		dec, err := Decompress(block)
+		require.NoError(t, err)
+		require.Equal(t, want, dec)
+		require.Zero(t, w.Len())
+	}
+
+	w, err := NewBlockWriter(Level1)
+	require.NoError(t, err)
+	require.ErrorIs(t, w.Match(3, 1), ErrInvalidToken) // nothing to copy yet
+	_, err = w.Finish()
+	require.ErrorIs(t, err, ErrEmptyInput)
+	_, err = NewBlockWriter(Auto)
+	require.ErrorIs(t, err, ErrUnknownLevel)
+}
+
+func TestCompressLegacyShort(t *testing.T) {
+	// The C encoder emits a single literal run below 12 bytes, its main
+	// loop ending at ip + length - 12. The port used to search for matches
+	// there and read past the input.
+	for n := 4; n < 12; n++ {
+		for _, input := range [][]byte{bytes.Repeat([]byte{'a'}, n), []byte("abcabcabcab")[:n]} {
+			for _, level := range []Level{Level1, Level2} {
+				enc, err := CompressLegacy(input, level)
+				require.NoError(t, err)
+				want := append([]byte{byte(n-1) | byte(level-1)<<5}, input...)
+				require.Equal(t, want, enc, "%d bytes at level %d", n, level)
+			}
+		}
+	}
+}
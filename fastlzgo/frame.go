@@ -0,0 +1,661 @@
+package fastlzgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+)
+
+/*
+A stream written by Writer is a frame header, a sequence of blocks and an
+end marker. All integers are little endian.
+
+	frame header (10 bytes)
+	  magic       4 bytes  'F' 'L' 'Z' 0x1a
+	  version     1 byte   1
+	  flags       1 byte   bit 0 set: blocks carry a checksum,
+	                       bit 1 set: a seek index follows the end marker,
+	                       other bits 0
+	  block size  4 bytes  largest original size of a block
+
+	block
+	  length      4 bytes  bits 0-30: size of the data below,
+	                       bit 31 set: the data is stored uncompressed
+	  original    4 bytes  original size, only for compressed blocks
+	  checksum    4 bytes  CRC-32C of the original data, only with flag bit 0
+	  data        length bytes, a FastLZ block or the original data
+
+	end marker
+	  length      4 bytes  0
+
+	seek index, only with flag bit 1
+	  entries     16 bytes per block: the offset of its header in the
+	              stream and of its data in the original, both 8 bytes
+	  size        8 bytes  original size of the stream
+	  count       4 bytes  number of entries
+	  magic       4 bytes  'F' 'L' 'Z' 'I'
+
+Every block is compressed on its own, so blocks can be decoded in any order.
+*/
+
+const (
+	frameVersion    = 1
+	frameHeaderSize = 10
+	frameChecksum   = 1 << 0
+	frameSeekable   = 1 << 1
+	frameStored     = 1 << 31
+
+	/* a FastLZ block decompresses to at most 255 bytes per byte, the */
+	/* length escape of level 2 matches */
+	maxExpansion = 255
+
+	// DefaultBlockSize is the block size of a Writer without WithBlockSize.
+	DefaultBlockSize = 64 << 10
+	// MinBlockSize and MaxBlockSize bound the block size of a stream.
+	MinBlockSize = 1 << 10
+	MaxBlockSize = 16 << 20
+)
+
+var frameMagic = [4]byte{'F', 'L', 'Z', 0x1a}
+
+var crc32c = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrChecksum is returned by Reader when a block does not match its
+	// checksum.
+	ErrChecksum = errors.New("checksum mismatch")
+	// ErrClosed is returned when writing to a closed Writer.
+	ErrClosed = errors.New("writer is closed")
+)
+
+// Encoder compresses the blocks of a stream, in place of the encoder of this
+// package. The backends of the codec package implement it.
+type Encoder interface {
+	// CompressLevelInto compresses src into dst, which is at least
+	// CompressBound(len(src)) bytes long, and returns the compressed size.
+	CompressLevelInto(dst, src []byte, level Level) (int, error)
+}
+
+// Decoder decompresses the blocks of a stream, in place of the decoder of
+// this package. The backends of the codec package implement it.
+type Decoder interface {
+	// DecompressInto decompresses src into dst and returns the size of the
+	// decompressed data.
+	DecompressInto(dst, src []byte) (int, error)
+}
+
+// WriterOption configures a Writer.
+type WriterOption func(*Writer) error
+
+// WithLevel sets the compression level of every block. The default is Auto.
+func WithLevel(level Level) WriterOption {
+	return func(w *Writer) error {
+		c, err := NewCompressor(level)
+		if err != nil {
+			return err
+		}
+		w.c = c
+		return nil
+	}
+}
+
+// WithEncoder compresses the blocks with e. CompressParallel calls e from
+// several goroutines at the same time.
+func WithEncoder(e Encoder) WriterOption {
+	return func(w *Writer) error {
+		w.enc = e
+		return nil
+	}
+}
+
+// WithBlockSize sets the largest original size of a block, between
+// MinBlockSize and MaxBlockSize. The default is DefaultBlockSize.
+func WithBlockSize(size int) WriterOption {
+	return func(w *Writer) error {
+		if size < MinBlockSize || size > MaxBlockSize {
+			return fmt.Errorf("block size %d out of range [%d, %d]", size, MinBlockSize, MaxBlockSize)
+		}
+		w.blockSize = size
+		return nil
+	}
+}
+
+// WithChecksum sets whether every block carries a CRC-32C of its original
+// data. Checksums are on by default.
+func WithChecksum(checksum bool) WriterOption {
+	return func(w *Writer) error {
+		w.checksum = checksum
+		return nil
+	}
+}
+
+// WithSeekable sets whether the stream ends with a seek index, for
+// random access with SeekableReader. The block size sets the granularity of
+// that access. Streams are not seekable by default.
+func WithSeekable(seekable bool) WriterOption {
+	return func(w *Writer) error {
+		w.seekable = seekable
+		return nil
+	}
+}
+
+// Writer compresses the data written to it into a stream of blocks.
+// Close must be called to write the end marker.
+type Writer struct {
+	w           io.Writer
+	c           *Compressor
+	enc         Encoder
+	blockSize   int
+	checksum    bool
+	concurrency int
+	seekable    bool
+
+	buf         []byte /* pending input, shorter than blockSize */
+	out         []byte /* block header and compressed data */
+	wroteHeader bool
+	closed      bool
+
+	err error
+
+	/* seek index */
+	written int64
+	size    int64
+	index   []seekEntry
+}
+
+// NewWriter returns a Writer compressing to w.
+func NewWriter(w io.Writer, opts ...WriterOption) (*Writer, error) {
+	zw := &Writer{
+		w:         w,
+		c:         &Compressor{},
+		blockSize: DefaultBlockSize,
+		checksum:  true,
+	}
+	for _, opt := range opts {
+		if err := opt(zw); err != nil {
+			return nil, err
+		}
+	}
+	return zw, nil
+}
+
+// Write compresses p. Data is written to the underlying writer one block at
+// a time, so up to a block of it may stay buffered until Flush or Close.
+func (w *Writer) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	n := 0
+	for len(p) > 0 {
+		/* full blocks are compressed in place */
+		if len(w.buf) == 0 && len(p) >= w.blockSize {
+			if err := w.writeBlock(p[:w.blockSize]); err != nil {
+				return n, err
+			}
+			p = p[w.blockSize:]
+			n += w.blockSize
+			continue
+		}
+
+		k := min(len(p), w.blockSize-len(w.buf))
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		n += k
+		if len(w.buf) == w.blockSize {
+			if err := w.writeBlock(w.buf); err != nil {
+				return n, err
+			}
+			w.buf = w.buf[:0]
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the buffered data as a block, and the frame header if it was
+// not written yet.
+func (w *Writer) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	err := w.writeBlock(w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
+
+// Close flushes the buffered data and writes the end marker. It does not
+// close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	w.closed = true
+	end := make([]byte, 4)
+	if w.seekable {
+		end = appendSeekIndex(end, w.index, w.size)
+	}
+	if _, err := w.w.Write(end); err != nil {
+		w.err = err
+		return err
+	}
+	w.err = ErrClosed
+	return nil
+}
+
+// Reset discards the Writer's state and makes it write a new stream to w,
+// keeping its options.
+func (w *Writer) Reset(dst io.Writer) {
+	w.w = dst
+	w.buf = w.buf[:0]
+	w.wroteHeader = false
+	w.closed = false
+	w.err = nil
+	w.written = 0
+	w.size = 0
+	w.index = w.index[:0]
+}
+
+func (w *Writer) writeHeader() error {
+	if w.wroteHeader {
+		return nil
+	}
+
+	hdr := appendFrameHeader(make([]byte, 0, frameHeaderSize), w.blockSize, w.checksum, w.seekable)
+	if _, err := w.w.Write(hdr); err != nil {
+		w.err = err
+		return err
+	}
+	w.written = frameHeaderSize
+	w.wroteHeader = true
+	return nil
+}
+
+func (w *Writer) writeBlock(block []byte) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	var err error
+	w.out, err = appendBlock(w.out[:0], w.encoder(w.c), w.c.level, block, w.checksum)
+	if err != nil {
+		w.err = err
+		return err
+	}
+	if _, err := w.w.Write(w.out); err != nil {
+		w.err = err
+		return err
+	}
+	if w.seekable {
+		w.index = append(w.index, seekEntry{w.written, w.size})
+	}
+	w.written += int64(len(w.out))
+	w.size += int64(len(block))
+	return nil
+}
+
+// encoder returns the encoder set with WithEncoder, or c at the level of the
+// Writer.
+func (w *Writer) encoder(c *Compressor) Encoder {
+	if w.enc != nil {
+		return w.enc
+	}
+	return compressorEncoder{c}
+}
+
+type compressorEncoder struct{ c *Compressor }
+
+func (e compressorEncoder) CompressLevelInto(dst, src []byte, level Level) (int, error) {
+	return e.c.compress(level, src, len(src), dst), nil
+}
+
+// appendFrameHeader appends a frame header to dst.
+func appendFrameHeader(dst []byte, blockSize int, checksum, seekable bool) []byte {
+	var flags byte
+	if checksum {
+		flags |= frameChecksum
+	}
+	if seekable {
+		flags |= frameSeekable
+	}
+	dst = append(dst, frameMagic[:]...)
+	dst = append(dst, frameVersion, flags)
+	return binary.LittleEndian.AppendUint32(dst, uint32(blockSize))
+}
+
+// appendBlock appends block to dst, compressed with e or stored if it does
+// not compress.
+func appendBlock(dst []byte, e Encoder, level Level, block []byte, checksum bool) ([]byte, error) {
+	hdrLen := 8
+	if checksum {
+		hdrLen += 4
+	}
+	n := len(dst)
+	bound := hdrLen + CompressBound(len(block))
+	dst = slices.Grow(dst, bound)
+	out := dst[n : n+bound]
+
+	size, err := e.CompressLevelInto(out[hdrLen:], block, level)
+	if err != nil {
+		return dst[:n], err
+	}
+	if size >= len(block) {
+		/* incompressible, store it without the original size */
+		hdrLen -= 4
+		binary.LittleEndian.PutUint32(out, uint32(len(block))|frameStored)
+		size = copy(out[hdrLen:], block)
+	} else {
+		binary.LittleEndian.PutUint32(out, uint32(size))
+		binary.LittleEndian.PutUint32(out[4:], uint32(len(block)))
+	}
+	if checksum {
+		binary.LittleEndian.PutUint32(out[hdrLen-4:], crc32.Checksum(block, crc32c))
+	}
+	return dst[:n+hdrLen+size], nil
+}
+
+// Reader decompresses a stream written by Writer.
+type Reader struct {
+	r   io.Reader
+	dec Decoder
+
+	readHeader bool
+	checksum   bool
+	blockSize  int
+
+	maxDecoded int64
+	decoded    int64 /* decompressed bytes of the stream so far */
+
+	buf []byte /* compressed block */
+	out []byte /* decompressed block */
+	pos int    /* read position in out */
+	err error
+}
+
+// ReaderOption configures a Reader.
+type ReaderOption func(*Reader)
+
+// WithDecoder decompresses the blocks with d.
+func WithDecoder(d Decoder) ReaderOption {
+	return func(r *Reader) {
+		r.dec = d
+	}
+}
+
+// WithMaxDecodedSize limits the decompressed size of a stream to n bytes.
+// A block that would pass the limit fails with ErrTooLarge before it is
+// read, and no buffer larger than n is allocated. n <= 0 means no limit,
+// the default.
+func WithMaxDecodedSize(n int64) ReaderOption {
+	return func(r *Reader) {
+		r.maxDecoded = n
+	}
+}
+
+// NewReader returns a Reader decompressing from r. The frame header is read
+// by the first call to Read or WriteTo.
+func NewReader(r io.Reader, opts ...ReaderOption) *Reader {
+	zr := &Reader{r: r}
+	for _, opt := range opts {
+		opt(zr)
+	}
+	return zr
+}
+
+// Read reads decompressed data into p. It returns io.EOF after the end
+// marker; data following the end marker is not read.
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.pos == len(r.out) {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.readBlock()
+	}
+
+	n := copy(p, r.out[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+// WriteTo writes the decompressed data to w until the end marker.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+	var written int64
+	for {
+		if r.pos < len(r.out) {
+			n, err := w.Write(r.out[r.pos:])
+			written += int64(n)
+			r.pos += n
+			if err != nil {
+				return written, err
+			}
+			continue
+		}
+		if r.err != nil {
+			if r.err == io.EOF {
+				return written, nil
+			}
+			return written, r.err
+		}
+		r.err = r.readBlock()
+	}
+}
+
+// Reset discards the Reader's state and makes it read a new stream from r.
+func (r *Reader) Reset(src io.Reader) {
+	r.r = src
+	r.readHeader = false
+	r.decoded = 0
+	r.out = r.out[:0]
+	r.pos = 0
+	r.err = nil
+}
+
+func (r *Reader) readFull(p []byte) error {
+	_, err := io.ReadFull(r.r, p)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (r *Reader) readFrameHeader() error {
+	var hdr [frameHeaderSize]byte
+	if err := r.readFull(hdr[:]); err != nil {
+		return err
+	}
+
+	fh, err := parseFrameHeader(hdr[:])
+	if err != nil {
+		return err
+	}
+	r.checksum = fh.checksum
+	r.blockSize = fh.blockSize
+	r.readHeader = true
+	return nil
+}
+
+func (r *Reader) readBlock() error {
+	if !r.readHeader {
+		if err := r.readFrameHeader(); err != nil {
+			return err
+		}
+	}
+
+	var hdr [12]byte
+	if err := r.readFull(hdr[:4]); err != nil {
+		return err
+	}
+	hdrLen := blockHeaderLen(hdr[:], r.checksum)
+	if hdrLen == 0 {
+		return io.EOF
+	}
+	if err := r.readFull(hdr[4:hdrLen]); err != nil {
+		return err
+	}
+	h, err := parseBlockHeader(hdr[:hdrLen], r.checksum, r.blockSize)
+	if err != nil {
+		return err
+	}
+
+	if r.tooLarge(int64(h.original)) {
+		r.out = r.out[:0]
+		r.pos = 0
+		return ErrTooLarge
+	}
+	r.decoded += int64(h.original)
+
+	bufSize := r.blockSize
+	if r.maxDecoded > 0 {
+		bufSize = int(min(int64(bufSize), r.maxDecoded))
+	}
+	if cap(r.buf) < bufSize {
+		r.buf = make([]byte, bufSize)
+	}
+	if cap(r.out) < bufSize {
+		r.out = make([]byte, bufSize)
+	}
+	r.buf = r.buf[:h.length]
+	r.out = r.out[:h.original]
+	r.pos = 0
+	if err := r.readFull(r.buf); err != nil {
+		r.out = r.out[:0]
+		return err
+	}
+	if err := decodeBlock(r.out, r.buf, h, r.dec); err != nil {
+		r.out = r.out[:0]
+		return err
+	}
+	return nil
+}
+
+// tooLarge reports whether n more decompressed bytes pass the limit set
+// with WithMaxDecodedSize.
+func (r *Reader) tooLarge(n int64) bool {
+	return r.maxDecoded > 0 && n > r.maxDecoded-r.decoded
+}
+
+type frameHeader struct {
+	checksum  bool
+	seekable  bool
+	blockSize int
+}
+
+// parseFrameHeader checks a frame header and returns its fields.
+func parseFrameHeader(hdr []byte) (frameHeader, error) {
+	if len(hdr) < frameHeaderSize {
+		return frameHeader{}, io.ErrUnexpectedEOF
+	}
+	if [4]byte(hdr[:4]) != frameMagic {
+		return frameHeader{}, fmt.Errorf("%w: not a FastLZ stream", ErrCorrupt)
+	}
+	if hdr[4] != frameVersion {
+		return frameHeader{}, fmt.Errorf("%w: unsupported stream version %d", ErrCorrupt, hdr[4])
+	}
+	if hdr[5]&^(frameChecksum|frameSeekable) != 0 {
+		return frameHeader{}, fmt.Errorf("%w: unknown stream flags %#x", ErrCorrupt, hdr[5])
+	}
+	size := binary.LittleEndian.Uint32(hdr[6:])
+	if size < MinBlockSize || size > MaxBlockSize {
+		return frameHeader{}, fmt.Errorf("%w: block size %d out of range", ErrCorrupt, size)
+	}
+	return frameHeader{
+		checksum:  hdr[5]&frameChecksum != 0,
+		seekable:  hdr[5]&frameSeekable != 0,
+		blockSize: int(size),
+	}, nil
+}
+
+type blockHeader struct {
+	length   int /* size of the block data */
+	original int
+	stored   bool
+	checksum bool
+	crc      uint32
+}
+
+// blockHeaderLen returns the size of the block header starting with the
+// 4-byte length in hdr, or 0 for the end marker.
+func blockHeaderLen(hdr []byte, checksum bool) int {
+	length := binary.LittleEndian.Uint32(hdr)
+	if length == 0 {
+		return 0
+	}
+	n := 4
+	if length&frameStored == 0 {
+		n += 4
+	}
+	if checksum {
+		n += 4
+	}
+	return n
+}
+
+func parseBlockHeader(hdr []byte, checksum bool, blockSize int) (blockHeader, error) {
+	length := binary.LittleEndian.Uint32(hdr)
+	h := blockHeader{
+		stored:   length&frameStored != 0,
+		checksum: checksum,
+		length:   int(length &^ frameStored),
+	}
+	h.original = h.length
+	n := 4
+	if !h.stored {
+		h.original = int(binary.LittleEndian.Uint32(hdr[4:]))
+		n += 4
+		if h.length >= h.original {
+			return h, fmt.Errorf("%w: block of %d bytes compressed to %d", ErrCorrupt, h.original, h.length)
+		}
+		/* checked before the original size is allocated */
+		if h.original > maxExpansion*h.length {
+			return h, fmt.Errorf("%w: %d compressed bytes can not decompress to %d", ErrCorrupt, h.length, h.original)
+		}
+	}
+	if checksum {
+		h.crc = binary.LittleEndian.Uint32(hdr[n:])
+	}
+	if h.original == 0 || h.original > blockSize {
+		return h, fmt.Errorf("%w: block size %d out of range", ErrCorrupt, h.original)
+	}
+	return h, nil
+}
+
+// decodeBlock decodes the block data into dst, which is h.original bytes
+// long, with d or the decoder of this package if d is nil, and verifies its
+// checksum.
+func decodeBlock(dst, data []byte, h blockHeader, d Decoder) error {
+	if h.stored {
+		copy(dst, data)
+	} else {
+		var size int
+		var err error
+		if d != nil {
+			size, err = d.DecompressInto(dst, data)
+		} else {
+			size, err = fastlzDecompress(data, len(data), dst, len(dst))
+		}
+		if err != nil {
+			return err
+		}
+		if size != len(dst) {
+			return fmt.Errorf("%w: decompressed %d bytes, expected %d", ErrCorrupt, size, len(dst))
+		}
+	}
+
+	if h.checksum && crc32.Checksum(dst, crc32c) != h.crc {
+		return ErrChecksum
+	}
+	return nil
+}
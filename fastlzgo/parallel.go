@@ -0,0 +1,156 @@
+package fastlzgo
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// WithConcurrency sets the number of goroutines CompressParallel uses.
+// n <= 0 means runtime.GOMAXPROCS(0), the default. A Writer compresses on
+// the calling goroutine and ignores it.
+func WithConcurrency(n int) WriterOption {
+	return func(w *Writer) error {
+		w.concurrency = n
+		return nil
+	}
+}
+
+// CompressParallel compresses input into the stream format written by
+// Writer, compressing its blocks on a bounded number of goroutines. The
+// output only depends on the input and the level, block size and checksum
+// options, not on the number of goroutines.
+func CompressParallel(input []byte, opts ...WriterOption) ([]byte, error) {
+	w, err := NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := make([][]byte, (len(input)+w.blockSize-1)/w.blockSize)
+	errs := make([]error, len(blocks))
+	parallel(len(blocks), w.concurrency, func() func(i int) {
+		e := w.encoder(&Compressor{})
+		return func(i int) {
+			block := input[i*w.blockSize : min(len(input), (i+1)*w.blockSize)]
+			blocks[i], errs[i] = appendBlock(nil, e, w.c.level, block, w.checksum)
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	size := frameHeaderSize + 4
+	for _, b := range blocks {
+		size += len(b)
+	}
+	if w.seekable {
+		size += len(blocks)*16 + seekFooterSize
+	}
+
+	out := appendFrameHeader(make([]byte, 0, size), w.blockSize, w.checksum, w.seekable)
+	var index []seekEntry
+	for i, b := range blocks {
+		if w.seekable {
+			index = append(index, seekEntry{int64(len(out)), int64(i * w.blockSize)})
+		}
+		out = append(out, b...)
+	}
+	out = binary.LittleEndian.AppendUint32(out, 0)
+	if w.seekable {
+		out = appendSeekIndex(out, index, int64(len(input)))
+	}
+	return out, nil
+}
+
+// DecompressParallel decompresses a stream written by Writer or
+// CompressParallel, decompressing its blocks on up to concurrency
+// goroutines. concurrency <= 0 means runtime.GOMAXPROCS(0). Of the options,
+// only WithMaxDecodedSize applies; the output is not allocated when the
+// block headers add up to more.
+func DecompressParallel(stream []byte, concurrency int, opts ...ReaderOption) ([]byte, error) {
+	zr := NewReader(nil, opts...)
+	fh, err := parseFrameHeader(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	/* the block headers give every block its place in the output */
+	type block struct {
+		blockHeader
+		data   []byte
+		offset int
+	}
+	var blocks []block
+	p, size := frameHeaderSize, 0
+	for {
+		if len(stream)-p < 4 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		hdrLen := blockHeaderLen(stream[p:], fh.checksum)
+		if hdrLen == 0 {
+			break
+		}
+		if len(stream)-p < hdrLen {
+			return nil, io.ErrUnexpectedEOF
+		}
+		h, err := parseBlockHeader(stream[p:p+hdrLen], fh.checksum, fh.blockSize)
+		if err != nil {
+			return nil, err
+		}
+		p += hdrLen
+		if len(stream)-p < h.length {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if zr.tooLarge(int64(size) + int64(h.original)) {
+			return nil, ErrTooLarge
+		}
+		blocks = append(blocks, block{h, stream[p : p+h.length], size})
+		p += h.length
+		size += h.original
+	}
+
+	output := make([]byte, size)
+	errs := make([]error, len(blocks))
+	parallel(len(blocks), concurrency, func() func(i int) {
+		return func(i int) {
+			b := blocks[i]
+			if err := decodeBlock(output[b.offset:b.offset+b.original], b.data, b.blockHeader, nil); err != nil {
+				errs[i] = fmt.Errorf("block %d: %w", i, err)
+			}
+		}
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return output, nil
+}
+
+// parallel calls a function made by newWorker for every index below n, on
+// up to concurrency goroutines that each make their own.
+func parallel(n, concurrency int, newWorker func() func(i int)) {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+	concurrency = min(concurrency, n)
+
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	wg.Add(concurrency)
+	for g := 0; g < concurrency; g++ {
+		go func() {
+			defer wg.Done()
+			work := newWorker()
+			for i := int(next.Add(1) - 1); i < n; i = int(next.Add(1) - 1) {
+				work(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,86 @@
+package fastlzgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// prefixLen is the size of the uncompressed length in front of a prefixed
+// block.
+const prefixLen = 4
+
+// CompressPrefixed compresses the input data into a size-prefixed block: a
+// 4-byte little endian uncompressed length followed by the block of
+// CompressLegacy with the given level. An empty input gives only the length.
+func CompressPrefixed(input []byte, level Level) ([]byte, error) {
+	length := len(input)
+	if uint64(length) > math.MaxUint32 {
+		return nil, errors.New("input too large for a 4-byte length")
+	}
+
+	output := make([]byte, prefixLen+CompressBound(length))
+	binary.LittleEndian.PutUint32(output, uint32(length))
+	if length == 0 {
+		return output[:prefixLen], nil
+	}
+
+	var size int
+	switch level {
+	case Auto:
+		size = fastlzCompress(input, length, output[prefixLen:])
+	case Level1:
+		size = fastlz1Compress(input, length, output[prefixLen:])
+	case Level2:
+		size = fastlz2Compress(input, length, output[prefixLen:])
+	default:
+		return nil, ErrUnknownLevel
+	}
+
+	if size == 0 {
+		return nil, errors.New("error compressing data")
+	}
+
+	return output[:prefixLen+size], nil
+}
+
+// DecompressPrefixed decompresses a block written by CompressPrefixed. The
+// block is checked to decompress to exactly the declared length before the
+// output is allocated, so a corrupt length is rejected with ErrCorrupt
+// instead of being allocated. Use DecompressPrefixedLimit for untrusted
+// blocks.
+func DecompressPrefixed(input []byte) ([]byte, error) {
+	return DecompressPrefixedLimit(input, math.MaxInt)
+}
+
+// DecompressPrefixedLimit is DecompressPrefixed, but it fails with
+// ErrTooLarge if the declared length is more than maxOutput, before reading
+// the FastLZ block.
+func DecompressPrefixedLimit(input []byte, maxOutput int) ([]byte, error) {
+	if len(input) < prefixLen {
+		if len(input) == 0 {
+			return nil, ErrEmptyInput
+		}
+		return nil, fmt.Errorf("%w: truncated length prefix", ErrCorrupt)
+	}
+
+	declared := int(binary.LittleEndian.Uint32(input))
+	if declared > maxOutput {
+		return nil, ErrTooLarge
+	}
+	block := input[prefixLen:]
+	if err := checkDeclaredLen(block, declared); err != nil {
+		return nil, err
+	}
+	if declared == 0 {
+		return []byte{}, nil
+	}
+
+	output := make([]byte, declared)
+	if _, err := fastlzDecompress(block, len(block), output, declared); err != nil {
+		return nil, err
+	}
+
+	return output, nil
+}
@@ -0,0 +1,296 @@
+package fastlzgo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	seekFooterSize  = 16
+	seekCacheBlocks = 8
+)
+
+var seekMagic = [4]byte{'F', 'L', 'Z', 'I'}
+
+type seekEntry struct {
+	compressed int64 /* offset of the block header in the stream */
+	offset     int64 /* offset of the block data in the original */
+}
+
+// appendSeekIndex appends the seek index of a stream to dst.
+func appendSeekIndex(dst []byte, index []seekEntry, size int64) []byte {
+	for _, e := range index {
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(e.compressed))
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(e.offset))
+	}
+	dst = binary.LittleEndian.AppendUint64(dst, uint64(size))
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(len(index)))
+	return append(dst, seekMagic[:]...)
+}
+
+// SeekableReader reads a stream written with WithSeekable at random
+// offsets. It only decompresses the blocks a read touches and keeps the
+// last few of them, so reads close to each other are cheap.
+//
+// ReadAt may be called by multiple goroutines at the same time; Read and
+// Seek share a position and may not.
+type SeekableReader struct {
+	r        io.ReaderAt
+	checksum bool
+	size     int64
+	index    []seekEntry
+	end      int64 /* offset of the end marker in the stream */
+	pos      int64
+
+	mu    sync.Mutex
+	buf   []byte
+	cache []seekBlock /* most recently used first */
+}
+
+type seekBlock struct {
+	i    int
+	data []byte
+}
+
+// NewSeekableReader returns a SeekableReader for the stream of the given
+// size in r. It reads the frame header and the seek index. Of the options,
+// only WithMaxDecodedSize applies, to the decompressed size in the index.
+func NewSeekableReader(r io.ReaderAt, size int64, opts ...ReaderOption) (*SeekableReader, error) {
+	zr := NewReader(nil, opts...)
+	hdr := make([]byte, frameHeaderSize)
+	if err := readFullAt(r, hdr, 0); err != nil {
+		return nil, err
+	}
+	fh, err := parseFrameHeader(hdr)
+	if err != nil {
+		return nil, err
+	}
+	if !fh.seekable {
+		return nil, fmt.Errorf("%w: stream has no seek index", ErrCorrupt)
+	}
+
+	footer := make([]byte, seekFooterSize)
+	if size < frameHeaderSize+4+seekFooterSize {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err := readFullAt(r, footer, size-seekFooterSize); err != nil {
+		return nil, err
+	}
+	if [4]byte(footer[12:]) != seekMagic {
+		return nil, fmt.Errorf("%w: bad seek index", ErrCorrupt)
+	}
+	total := int64(binary.LittleEndian.Uint64(footer))
+	count := int64(binary.LittleEndian.Uint32(footer[8:]))
+	end := size - seekFooterSize - count*16 - 4
+	if total < 0 || end < frameHeaderSize {
+		return nil, fmt.Errorf("%w: bad seek index", ErrCorrupt)
+	}
+	if zr.tooLarge(total) {
+		return nil, ErrTooLarge
+	}
+
+	entries := make([]byte, 4+count*16)
+	if err := readFullAt(r, entries, end); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(entries) != 0 {
+		return nil, fmt.Errorf("%w: missing end marker", ErrCorrupt)
+	}
+
+	/* blocks follow each other and hold at most a block size each */
+	index := make([]seekEntry, count)
+	blockSize := int64(fh.blockSize)
+	for i := range index {
+		e := entries[4+i*16:]
+		index[i] = seekEntry{
+			compressed: int64(binary.LittleEndian.Uint64(e)),
+			offset:     int64(binary.LittleEndian.Uint64(e[8:])),
+		}
+		var ok bool
+		if i == 0 {
+			ok = index[i].compressed == frameHeaderSize && index[i].offset == 0
+		} else {
+			d := index[i].offset - index[i-1].offset
+			ok = index[i].compressed > index[i-1].compressed+4 && d > 0 && d <= blockSize
+		}
+		if !ok {
+			return nil, fmt.Errorf("%w: bad seek index", ErrCorrupt)
+		}
+	}
+	if count == 0 && (total != 0 || end != frameHeaderSize) {
+		return nil, fmt.Errorf("%w: bad seek index", ErrCorrupt)
+	}
+	if count > 0 {
+		last := index[count-1]
+		if last.compressed+4 >= end || total <= last.offset || total-last.offset > blockSize {
+			return nil, fmt.Errorf("%w: bad seek index", ErrCorrupt)
+		}
+	}
+
+	return &SeekableReader{
+		r:        r,
+		checksum: fh.checksum,
+		size:     total,
+		index:    index,
+		end:      end,
+	}, nil
+}
+
+// Size returns the decompressed size of the stream.
+func (s *SeekableReader) Size() int64 {
+	return s.size
+}
+
+// ReadAt reads len(p) decompressed bytes starting at off.
+func (s *SeekableReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	n := 0
+	for n < len(p) && off < s.size {
+		i := sort.Search(len(s.index), func(i int) bool { return s.index[i].offset > off }) - 1
+		k, err := s.copyBlock(p[n:], i, off-s.index[i].offset)
+		if err != nil {
+			return n, err
+		}
+		n += k
+		off += int64(k)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read reads decompressed data from the current position.
+func (s *SeekableReader) Read(p []byte) (int, error) {
+	if s.pos >= s.size {
+		return 0, io.EOF
+	}
+	n, err := s.ReadAt(p, s.pos)
+	s.pos += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek sets the position of the next Read, relative to whence.
+func (s *SeekableReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += s.pos
+	case io.SeekEnd:
+		offset += s.size
+	default:
+		return s.pos, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return s.pos, errors.New("negative position")
+	}
+	s.pos = offset
+	return offset, nil
+}
+
+// copyBlock copies block i from off into dst. The cache is locked while
+// copying, since its buffers are reused.
+func (s *SeekableReader) copyBlock(dst []byte, i int, off int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.block(i)
+	if err != nil {
+		return 0, err
+	}
+	return copy(dst, data[off:]), nil
+}
+
+// block returns the decompressed block i, from the cache if it is there.
+func (s *SeekableReader) block(i int) ([]byte, error) {
+	for j, b := range s.cache {
+		if b.i == i {
+			copy(s.cache[1:j+1], s.cache[:j])
+			s.cache[0] = b
+			return b.data, nil
+		}
+	}
+
+	end := s.end
+	if i+1 < len(s.index) {
+		end = s.index[i+1].compressed
+	}
+	original := s.size - s.index[i].offset
+	if i+1 < len(s.index) {
+		original = s.index[i+1].offset - s.index[i].offset
+	}
+
+	/*
+	 * the header comes first: the index offsets are untrusted, so the gap
+	 * to the next block is only read once the header accounts for it
+	 */
+	gap := end - s.index[i].compressed
+	var hdr [12]byte
+	hdrBuf := hdr[:min(gap, int64(len(hdr)))]
+	if err := readFullAt(s.r, hdrBuf, s.index[i].compressed); err != nil {
+		return nil, err
+	}
+	if len(hdrBuf) < 4 {
+		return nil, fmt.Errorf("%w: bad block %d", ErrCorrupt, i)
+	}
+	hdrLen := blockHeaderLen(hdrBuf, s.checksum)
+	if hdrLen == 0 || hdrLen > len(hdrBuf) {
+		return nil, fmt.Errorf("%w: bad block %d", ErrCorrupt, i)
+	}
+	/* the header's length is at most the original size, a block size at most */
+	h, err := parseBlockHeader(hdrBuf[:hdrLen], s.checksum, int(original))
+	if err != nil {
+		return nil, err
+	}
+	if h.original != int(original) || int64(hdrLen+h.length) != gap {
+		return nil, fmt.Errorf("%w: block %d does not match the seek index", ErrCorrupt, i)
+	}
+
+	if cap(s.buf) < h.length {
+		s.buf = make([]byte, h.length)
+	}
+	buf := s.buf[:h.length]
+	if err := readFullAt(s.r, buf, s.index[i].compressed+int64(hdrLen)); err != nil {
+		return nil, err
+	}
+
+	/* reuse the buffer of the least recently used block */
+	var data []byte
+	if len(s.cache) == seekCacheBlocks {
+		data = s.cache[len(s.cache)-1].data
+		s.cache = s.cache[:len(s.cache)-1]
+	}
+	if cap(data) < h.original {
+		data = make([]byte, h.original)
+	}
+	data = data[:h.original]
+	if err := decodeBlock(data, buf, h, nil); err != nil {
+		return nil, err
+	}
+
+	s.cache = append(s.cache, seekBlock{})
+	copy(s.cache[1:], s.cache)
+	s.cache[0] = seekBlock{i, data}
+	return data, nil
+}
+
+func readFullAt(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if n == len(p) {
+		return nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package fastlzgo
+
+import "io"
+
+// Token is an instruction of a compressed block, as returned by
+// TokenReader.
+type Token struct {
+	Kind   TokenKind
+	Offset int // offset of the token in the block
+	// Length is the number of bytes the token adds to the output, 0 for
+	// TokenHeader.
+	Length int
+	// Distance is how far back a match copies from, 1 for the last byte
+	// written. It is 0 for the other kinds.
+	Distance int
+	// Literal holds the bytes of a TokenLiteral. It aliases the block.
+	Literal []byte
+	// Level is the level from the header bits, only set for TokenHeader.
+	Level Level
+}
+
+// TokenReader walks the instructions of a compressed block of either level
+// without decompressing it. It checks the block like Validate as it goes,
+// so applying the tokens in order rebuilds the decompressed data.
+type TokenReader struct {
+	block []byte
+	level Level
+	ip    uint
+	op    uint
+	err   error
+}
+
+// NewTokenReader returns a TokenReader for block. Its first token is the
+// TokenHeader with the level of the block.
+func NewTokenReader(block []byte) *TokenReader {
+	return &TokenReader{block: block}
+}
+
+// Next returns the next token. It returns io.EOF after the last one and a
+// *CorruptError at the first malformed token, which it keeps returning.
+func (r *TokenReader) Next() (Token, error) {
+	if r.err != nil {
+		return Token{}, r.err
+	}
+	t, err := r.next()
+	if err != nil {
+		r.err = err
+		return Token{}, err
+	}
+	return t, nil
+}
+
+// Decoded returns the number of bytes the tokens returned so far produce.
+func (r *TokenReader) Decoded() int {
+	return int(r.op)
+}
+
+func (r *TokenReader) next() (Token, error) {
+	input := r.block
+	ip_limit := uint(len(input))
+	if r.level == 0 {
+		if ip_limit == 0 {
+			return Token{}, ErrEmptyInput
+		}
+		/* magic identifier for compression level */
+		level := Level(input[0]>>5) + 1
+		if level != Level1 && level != Level2 {
+			return Token{}, corruptError(0, TokenHeader)
+		}
+		r.level = level
+		return Token{Kind: TokenHeader, Level: level}, nil
+	}
+	if r.ip >= ip_limit {
+		return Token{}, io.EOF
+	}
+
+	anchor := r.ip
+	ip := r.ip
+	ctrl := uint(input[ip])
+	if ip == 0 {
+		ctrl &= 31
+	}
+	ip++
+
+	if ctrl < 32 {
+		ctrl++
+		if ip+ctrl > ip_limit {
+			return Token{}, corruptError(anchor, TokenLiteral)
+		}
+		t := Token{Kind: TokenLiteral, Offset: int(anchor), Length: int(ctrl), Literal: input[ip : ip+ctrl : ip+ctrl]}
+		r.ip = ip + ctrl
+		r.op += ctrl
+		return t, nil
+	}
+
+	len := (ctrl >> 5) - 1
+	ofs := (ctrl & 31) << 8
+	if len == 7-1 {
+		if r.level == Level1 {
+			if ip >= ip_limit {
+				return Token{}, corruptError(anchor, TokenMatch)
+			}
+			len += uint(input[ip])
+			ip++
+		} else {
+			for code := byte(255); code == 255; {
+				if ip >= ip_limit {
+					return Token{}, corruptError(anchor, TokenMatch)
+				}
+				code = input[ip]
+				ip++
+				len += uint(code)
+			}
+		}
+	}
+	if ip >= ip_limit {
+		return Token{}, corruptError(anchor, TokenMatch)
+	}
+	code := input[ip]
+	ip++
+	distance := ofs + uint(code) + 1
+	kind := TokenMatch
+
+	/* match from 16-bit distance */
+	if r.level == Level2 && code == 255 && ofs == (31<<8) {
+		kind = TokenFarMatch
+		if ip+2 > ip_limit {
+			return Token{}, corruptError(anchor, kind)
+		}
+		distance = uint(input[ip])<<8 + uint(input[ip+1]) + MAX_DISTANCE2 + 1
+		ip += 2
+	}
+
+	/* the reference must point into the output produced so far */
+	if distance > r.op {
+		return Token{}, corruptError(anchor, kind)
+	}
+	r.ip = ip
+	r.op += len + 3
+	return Token{Kind: kind, Offset: int(anchor), Length: int(len + 3), Distance: int(distance)}, nil
+}
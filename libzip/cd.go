@@ -0,0 +1,150 @@
+package libzip
+
+import (
+	"fmt"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+)
+
+// CdCompress compresses data with the run-length scheme of LibZip.cdCompress.
+//
+// Runs of up to 128 zero bytes become 0x00 followed by the run length minus
+// one, and runs of up to 32 0xff bytes become 0x00 followed by 0x80 plus the
+// run length minus one. Other bytes are copied. The first 4 bytes of the
+// result are then bitwise negated, as LibZip.cdFallback expects.
+func CdCompress(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		switch c := data[i]; c {
+		case 0x00:
+			n := 1
+			for n < 0x80 && i+n < len(data) && data[i+n] == 0x00 {
+				n++
+			}
+			out = append(out, 0x00, byte(n-1))
+			i += n
+		case 0xff:
+			n := 1
+			for n < 0x20 && i+n < len(data) && data[i+n] == 0xff {
+				n++
+			}
+			out = append(out, 0x00, 0x80|byte(n-1))
+			i += n
+		default:
+			out = append(out, c)
+			i++
+		}
+	}
+
+	flipSelector(out)
+	return out
+}
+
+// CdDecompress reverses CdCompress, as LibZip.cdDecompress does for
+// well-formed data. Empty data decompresses to empty output.
+func CdDecompress(data []byte) ([]byte, error) {
+	in := append([]byte{}, data...)
+	flipSelector(in)
+
+	out := make([]byte, 0, len(in)*2)
+	for i := 0; i < len(in); i++ {
+		c := in[i]
+		if c != 0x00 {
+			out = append(out, c)
+			continue
+		}
+
+		if i+1 >= len(in) {
+			return nil, fmt.Errorf("%w: truncated run at offset %d", fastlzgo.ErrCorrupt, i)
+		}
+		i++
+		d := in[i]
+		if d <= 0x7f {
+			out = append(out, make([]byte, int(d)+1)...)
+			continue
+		}
+		if d&0x7f >= 0x20 {
+			return nil, fmt.Errorf("%w: 0xff run longer than 32 bytes at offset %d", fastlzgo.ErrCorrupt, i-1)
+		}
+		for n := int(d&0x7f) + 1; n > 0; n-- {
+			out = append(out, 0xff)
+		}
+	}
+	return out, nil
+}
+
+// CdCompressHex is CdCompress over hex strings, with or without a 0x prefix.
+// The result has a 0x prefix.
+func CdCompressHex(data string) (string, error) {
+	b, err := DecodeHex(data)
+	if err != nil {
+		return "", err
+	}
+	return EncodeHex(CdCompress(b)), nil
+}
+
+// CdDecompressHex is CdDecompress over hex strings, with or without a 0x
+// prefix. The result has a 0x prefix.
+func CdDecompressHex(data string) (string, error) {
+	b, err := DecodeHex(data)
+	if err != nil {
+		return "", err
+	}
+	dec, err := CdDecompress(b)
+	if err != nil {
+		return "", err
+	}
+	return EncodeHex(dec), nil
+}
+
+// flipSelector negates the first 4 bytes, which hold the function selector
+// when the data is calldata.
+func flipSelector(b []byte) {
+	for i := 0; i < 4 && i < len(b); i++ {
+		b[i] = ^b[i]
+	}
+}
+
+// Method is a LibZip compression method.
+type Method int
+
+const (
+	Flz Method = iota // LibZip.flzCompress
+	Cd                // LibZip.cdCompress
+)
+
+func (m Method) String() string {
+	switch m {
+	case Flz:
+		return "flz"
+	case Cd:
+		return "cd"
+	}
+	return fmt.Sprintf("Method(%d)", int(m))
+}
+
+// CalldataGas returns the calldata gas of b: 4 per zero byte and 16 per
+// non-zero byte.
+func CalldataGas(b []byte) uint64 {
+	var gas uint64
+	for _, c := range b {
+		if c == 0 {
+			gas += 4
+		} else {
+			gas += 16
+		}
+	}
+	return gas
+}
+
+// Cheapest compresses data with both FlzCompress and CdCompress and returns
+// the result with the lower calldata gas. Cd wins ties, since it is cheaper
+// to decompress on chain.
+func Cheapest(data []byte) (Method, []byte) {
+	flz := FlzCompress(data)
+	cd := CdCompress(data)
+	if CalldataGas(flz) < CalldataGas(cd) {
+		return Flz, flz
+	}
+	return Cd, cd
+}
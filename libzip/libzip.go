@@ -0,0 +1,79 @@
+// Package libzip mirrors the compression functions of Solady's LibZip
+// (https://github.com/Vectorized/solady/blob/main/src/utils/LibZip.sol).
+//
+// LibZip implements FastLZ 0.5.0 level 1, so FlzCompress is the byte-exact
+// port used by fastlzgo, checked against the C FastLZ and against Go models
+// of the LibZip assembly. No output of LibZip itself is committed yet to
+// compare with: testdata/solady/gen.sh writes it, with forge.
+package libzip
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+)
+
+// FlzCompress compresses data at FastLZ level 1, the encoding of
+// LibZip.flzCompress.
+// Empty data compresses to empty output.
+func FlzCompress(data []byte) []byte {
+	if len(data) == 0 {
+		return []byte{}
+	}
+
+	// level 1 compression of non-empty data can not fail
+	enc, _ := fastlzgo.CompressLevel(data, fastlzgo.Level1)
+	return enc
+}
+
+// FlzDecompress decompresses level 1 blocks, as LibZip.flzDecompress does
+// for well-formed data. LibZip only decodes level 1 blocks, so level 2 blocks
+// are rejected instead of being decoded into garbage.
+func FlzDecompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return []byte{}, nil
+	}
+	if data[0]>>5 != 0 {
+		return nil, &fastlzgo.CorruptError{Offset: 0, Kind: fastlzgo.TokenHeader}
+	}
+
+	return fastlzgo.Decompress(data)
+}
+
+// FlzCompressHex is FlzCompress over hex strings, with or without a 0x
+// prefix. The result has a 0x prefix, as Solidity tools print bytes.
+func FlzCompressHex(data string) (string, error) {
+	b, err := DecodeHex(data)
+	if err != nil {
+		return "", err
+	}
+	return EncodeHex(FlzCompress(b)), nil
+}
+
+// FlzDecompressHex is FlzDecompress over hex strings, with or without a 0x
+// prefix. The result has a 0x prefix.
+func FlzDecompressHex(data string) (string, error) {
+	b, err := DecodeHex(data)
+	if err != nil {
+		return "", err
+	}
+	dec, err := FlzDecompress(b)
+	if err != nil {
+		return "", err
+	}
+	return EncodeHex(dec), nil
+}
+
+// DecodeHex decodes a hex string with an optional 0x prefix.
+func DecodeHex(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		s = s[2:]
+	}
+	return hex.DecodeString(s)
+}
+
+// EncodeHex encodes b as a 0x-prefixed hex string.
+func EncodeHex(b []byte) string {
+	return "0x" + hex.EncodeToString(b)
+}
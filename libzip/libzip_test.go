@@ -0,0 +1,330 @@
+package libzip
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+	"github.com/stretchr/testify/require"
+)
+
+// testdata/fastlz_vectors.json holds fastlz_compress_level(1, ...) of the
+// FastLZ commit LibZip implements, vendored by the cgo package. The vectors
+// are also checked against a transliteration of the LibZip assembly below.
+// testdata/solady_vectors.json, written by testdata/solady/gen.sh, would hold
+// the output of LibZip.flzCompress and LibZip.cdCompress run by forge, with
+// the Solady commit in testdata/SOLADY_VERSION.
+type vector struct {
+	Name       string `json:"name"`
+	Data       string `json:"data"`
+	Compressed string `json:"compressed"`
+	Cd         string `json:"cd,omitempty"`
+}
+
+func loadVectors(t *testing.T, name string) []vector {
+	b, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	var vs []vector
+	require.NoError(t, json.Unmarshal(b, &vs))
+	require.NotEmpty(t, vs)
+	return vs
+}
+
+func TestVectors(t *testing.T) {
+	for _, v := range loadVectors(t, "fastlz_vectors.json") {
+		t.Run(v.Name, func(t *testing.T) {
+			enc, err := FlzCompressHex(v.Data)
+			require.NoError(t, err)
+			require.Equal(t, v.Compressed, enc)
+
+			dec, err := FlzDecompressHex(v.Compressed)
+			require.NoError(t, err)
+			require.Equal(t, v.Data, dec)
+
+			data, err := DecodeHex(v.Data)
+			require.NoError(t, err)
+			require.Equal(t, v.Compressed, EncodeHex(soladyFlzCompress(data)))
+			compressed, err := DecodeHex(v.Compressed)
+			require.NoError(t, err)
+			require.Equal(t, v.Data, EncodeHex(soladyFlzDecompress(compressed)))
+		})
+	}
+}
+
+func TestSoladyVectors(t *testing.T) {
+	if _, err := os.Stat("testdata/solady_vectors.json"); os.IsNotExist(err) {
+		t.Skip("no output of Solady's LibZip committed, run testdata/solady/gen.sh")
+	}
+	version, err := os.ReadFile("testdata/SOLADY_VERSION")
+	require.NoError(t, err)
+	t.Logf("solady %s", strings.TrimSpace(string(version)))
+
+	for _, v := range loadVectors(t, "solady_vectors.json") {
+		t.Run(v.Name, func(t *testing.T) {
+			enc, err := FlzCompressHex(v.Data)
+			require.NoError(t, err)
+			require.Equal(t, v.Compressed, enc)
+			dec, err := FlzDecompressHex(v.Compressed)
+			require.NoError(t, err)
+			require.Equal(t, v.Data, dec)
+
+			require.NotEmpty(t, v.Cd)
+			enc, err = CdCompressHex(v.Data)
+			require.NoError(t, err)
+			require.Equal(t, v.Cd, enc)
+			dec, err = CdDecompressHex(v.Cd)
+			require.NoError(t, err)
+			require.Equal(t, v.Data, dec)
+		})
+	}
+}
+
+func TestSoladyModel(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for n := 1; n < 2000; n += 7 {
+		data := make([]byte, n)
+		rnd.Read(data)
+		for i := range data {
+			if n%3 != 0 {
+				data[i] &= 3
+			}
+		}
+		enc := FlzCompress(data)
+		require.Equal(t, soladyFlzCompress(data), enc)
+		require.Equal(t, data, soladyFlzDecompress(enc))
+
+		dec, err := FlzDecompress(enc)
+		require.NoError(t, err)
+		require.Equal(t, data, dec)
+
+		cost, err := fastlzgo.CompressCost(data, fastlzgo.CalldataCost)
+		require.NoError(t, err)
+		require.Equal(t, data, soladyFlzDecompress(cost))
+	}
+}
+
+func TestHex(t *testing.T) {
+	enc, err := FlzCompressHex("")
+	require.NoError(t, err)
+	require.Equal(t, "0x", enc)
+	dec, err := FlzDecompressHex("0x")
+	require.NoError(t, err)
+	require.Equal(t, "0x", dec)
+
+	enc, err = FlzCompressHex("0X68656C6C6F")
+	require.NoError(t, err)
+	require.Equal(t, "0x0468656c6c6f", enc)
+	dec, err = FlzDecompressHex("0468656c6c6f")
+	require.NoError(t, err)
+	require.Equal(t, "0x68656c6c6f", dec)
+
+	_, err = FlzCompressHex("0x123")
+	require.Error(t, err)
+	_, err = FlzDecompressHex("0xzz")
+	require.Error(t, err)
+
+	// level 2 blocks are not understood by LibZip
+	_, err = FlzDecompressHex("0x2468656c6c6f")
+	require.Error(t, err)
+}
+
+func TestCd(t *testing.T) {
+	tests := []struct {
+		data, compressed string
+	}{
+		{"0x", "0x"},
+		{"0x00", "0xffff"},
+		{"0x01", "0xfe"},
+		{"0xffffff", "0xff7d"},
+		{"0xa9059cbb" + strings.Repeat("00", 32), "0x56fa6344001f"},
+		{"0x" + strings.Repeat("00", 200), "0xff80ffb8"},
+		{"0x" + strings.Repeat("ff", 40), "0xff60ff78"},
+		{"0x12345678ff9a00", "0xedcba98700809a0000"},
+	}
+	for _, tt := range tests {
+		enc, err := CdCompressHex(tt.data)
+		require.NoError(t, err)
+		require.Equal(t, tt.compressed, enc)
+
+		dec, err := CdDecompressHex(tt.compressed)
+		require.NoError(t, err)
+		require.Equal(t, tt.data, dec)
+	}
+
+	rnd := rand.New(rand.NewSource(1))
+	for n := 0; n < 1000; n += 3 {
+		data := make([]byte, n)
+		rnd.Read(data)
+		for i := range data {
+			switch data[i] % 4 {
+			case 0:
+				data[i] = 0x00
+			case 1:
+				data[i] = 0xff
+			}
+		}
+		dec, err := CdDecompress(CdCompress(data))
+		require.NoError(t, err)
+		require.Equal(t, data, dec)
+	}
+
+	// a trailing 0x00 has no run length
+	_, err := CdDecompressHex("0xff")
+	require.Error(t, err)
+	// 0xff runs are at most 32 bytes
+	_, err = CdDecompressHex("0x0101010100f0")
+	require.ErrorIs(t, err, fastlzgo.ErrCorrupt)
+}
+
+func TestCheapest(t *testing.T) {
+	transfer, err := DecodeHex("0xa9059cbb" + strings.Repeat("00", 12) + "d8da6bf26964af9d7eed9e03e53415d37aa96045" + strings.Repeat("00", 24) + "0de0b6b3a7640000")
+	require.NoError(t, err)
+	method, enc := Cheapest(transfer)
+	require.Equal(t, Cd, method)
+	require.Equal(t, CdCompress(transfer), enc)
+	require.Less(t, CalldataGas(enc), CalldataGas(transfer))
+
+	text := []byte(strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40))
+	method, enc = Cheapest(text)
+	require.Equal(t, Flz, method)
+	require.Equal(t, FlzCompress(text), enc)
+
+	require.Equal(t, uint64(4+16), CalldataGas([]byte{0, 1}))
+	require.Equal(t, "flz", Flz.String())
+	require.Equal(t, "cd", Cd.String())
+}
+
+// soladyFlzCompress transliterates the assembly of LibZip.flzCompress, with
+// memory pointers turned into offsets into data.
+func soladyFlzCompress(data []byte) []byte {
+	mem := append(append([]byte{}, data...), make([]byte, 32)...)
+	htab := make([]uint64, 0x2000)
+	var out []byte
+
+	u24 := func(p int) uint64 {
+		return uint64(mem[p+2])<<16 | uint64(mem[p+1])<<8 | uint64(mem[p])
+	}
+	cmp := func(p, q, e int) int {
+		l := 0
+		for e -= q; l < e; l++ {
+			if mem[p+l] != mem[q+l] {
+				e = 0
+			}
+		}
+		return l
+	}
+	literals := func(runs, src int) {
+		for ; runs >= 0x20; runs -= 0x20 {
+			out = append(out, 31)
+			out = append(out, mem[src:src+0x20]...)
+			src += 0x20
+		}
+		if runs == 0 {
+			return
+		}
+		out = append(out, byte(runs-1))
+		out = append(out, mem[src:src+runs]...)
+	}
+	mt := func(l, d int) {
+		for d--; l >= 263; l -= 262 {
+			out = append(out, byte(224+d>>8), 253, byte(d&0xff))
+		}
+		if l >= 7 {
+			out = append(out, byte(224+d>>8), byte(l-7), byte(d&0xff))
+			return
+		}
+		out = append(out, byte(l<<5+d>>8), byte(d&0xff))
+	}
+	hash := func(v uint64) uint64 {
+		return (2654435769 * v >> 19) & 0x1fff
+	}
+	setNextHash := func(ip int) int {
+		htab[hash(u24(ip))] = uint64(ip)
+		return ip + 1
+	}
+
+	a := 0
+	ipLimit := len(data) - 13
+	for ip := a + 2; ip < ipLimit; {
+		r, d := 0, 0
+		for {
+			s := u24(ip)
+			h := hash(s)
+			r = int(htab[h])
+			htab[h] = uint64(ip)
+			d = ip - r
+			if ip >= ipLimit {
+				break
+			}
+			ip++
+			if d <= 0x1fff && s == u24(r) {
+				break
+			}
+		}
+		if ip >= ipLimit {
+			break
+		}
+		ip--
+		if ip > a {
+			literals(ip-a, a)
+		}
+		l := cmp(r+3, ip+3, ipLimit+9)
+		mt(l, d)
+		ip = setNextHash(setNextHash(ip + l))
+		a = ip
+	}
+	literals(len(data)-a, a)
+	return out
+}
+
+// soladyFlzDecompress transliterates the assembly of LibZip.flzDecompress,
+// including its 32 byte wide copies.
+func soladyFlzDecompress(data []byte) []byte {
+	mem := append(append([]byte{}, data...), make([]byte, 64)...)
+	out := make([]byte, 0x20)
+	mstore := func(p int, w []byte) {
+		for len(out) < p+0x20 {
+			out = append(out, 0)
+		}
+		copy(out[p:p+0x20], w)
+	}
+	mload := func(b []byte, p int) []byte {
+		w := make([]byte, 0x20)
+		copy(w, b[p:])
+		return w
+	}
+
+	op := 0
+	for ip := 0; ip < len(data); {
+		c := int(mem[ip])
+		t := c >> 5
+		if t == 0 {
+			mstore(op, mload(mem, ip+1))
+			ip += 2 + c
+			op += 1 + c
+			continue
+		}
+		g := 0
+		l := 2 + t
+		if t == 7 {
+			g = 1
+			l = 2 + 7 + int(mem[ip+1])
+		}
+		s := (c&0x1f)<<8 + int(mem[ip+1+g]) + 1
+		r := op - s
+		f := min(s, 0x20)
+		for j := 0; ; {
+			mstore(op+j, mload(out, r+j))
+			j += f
+			if j >= l {
+				break
+			}
+		}
+		ip += 2 + g
+		op += l
+	}
+	return out[:op]
+}
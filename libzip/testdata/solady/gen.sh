@@ -0,0 +1,13 @@
+#!/bin/sh
+# Writes ../solady_vectors.json with Solady's LibZip, run by forge.
+# SOLADY_REF selects the Solady tag or commit; the commit used is recorded
+# in ../SOLADY_VERSION.
+set -eu
+cd "$(dirname "$0")"
+rm -rf lib
+git clone -q https://github.com/foundry-rs/forge-std lib/forge-std
+git clone -q https://github.com/Vectorized/solady lib/solady
+git -C lib/solady checkout -q "${SOLADY_REF:-main}"
+forge script script/Vectors.s.sol:Vectors
+git -C lib/solady rev-parse HEAD > ../SOLADY_VERSION
+rm -rf lib cache out
@@ -0,0 +1,32 @@
+// SPDX-License-Identifier: MIT
+pragma solidity ^0.8.4;
+
+import {Script} from "forge-std/Script.sol";
+import {LibZip} from "solady/utils/LibZip.sol";
+
+/// Writes ../solady_vectors.json with LibZip.flzCompress and LibZip.cdCompress
+/// of the inputs in inputs.json.
+contract Vectors is Script {
+    function run() external {
+        string memory inputs = vm.readFile("inputs.json");
+        string[] memory names = vm.parseJsonStringArray(inputs, ".names");
+        bytes[] memory data = vm.parseJsonBytesArray(inputs, ".data");
+
+        string memory out = "[\n";
+        for (uint256 i; i < data.length; ++i) {
+            out = string.concat(
+                out,
+                '  {\n    "name": "',
+                names[i],
+                '",\n    "data": "',
+                vm.toString(data[i]),
+                '",\n    "compressed": "',
+                vm.toString(LibZip.flzCompress(data[i])),
+                '",\n    "cd": "',
+                vm.toString(LibZip.cdCompress(data[i])),
+                i + 1 < data.length ? '"\n  },\n' : '"\n  }\n'
+            );
+        }
+        vm.writeFile("../solady_vectors.json", string.concat(out, "]\n"));
+    }
+}
@@ -1,5 +1,27 @@
 package main
 
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
 func main() {
+	var err error
+	if len(os.Args) > 1 && os.Args[1] == "opfee" {
+		err = runOpfee(os.Args[2:], os.Stdin, os.Stdout, os.Stderr)
+	} else {
+		err = runFastlz(os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	}
 
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		if !errors.Is(err, errFailed) {
+			fmt.Fprintln(os.Stderr, "fastlz:", err)
+		}
+		os.Exit(1)
+	}
 }
@@ -1,8 +1,17 @@
 package main
 
 import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/rabbitprincess/fastlz-go/codec"
 	"github.com/rabbitprincess/fastlz-go/fastlz"
 	"github.com/rabbitprincess/fastlz-go/fastlzgo"
 	"github.com/stretchr/testify/require"
@@ -17,6 +26,283 @@ func TestEncodeDecode(t *testing.T) {
 	dec, err := fastlzgo.Decompress(enc)
 	require.NoError(t, err)
 	require.Equal(t, input, dec)
+
+	// encode fastlzgo, decode fastlz
+	enc, err = fastlzgo.Compress(input)
+	require.NoError(t, err)
+
+	dec, err = fastlz.Decompress(enc)
+	require.NoError(t, err)
+	require.Equal(t, input, dec)
+}
+
+func TestDecodeHighRatio(t *testing.T) {
+	// encode fastlz, decode fastlzgo at 100:1 and larger ratios
+	inputs := [][]byte{
+		make([]byte, 2<<16),
+		make([]byte, 2<<20),
+		bytes.Repeat([]byte(`{"jsonrpc":"2.0","method":"eth_call","params":[]},`), 20000),
+	}
+	for _, input := range inputs {
+		enc, err := fastlz.Compress(input)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, len(input)/len(enc), 100)
+
+		dec, err := fastlzgo.Decompress(enc)
+		require.NoError(t, err)
+		require.Equal(t, input, dec)
+
+		dec, err = fastlzgo.DecompressSize(enc, len(input))
+		require.NoError(t, err)
+		require.Equal(t, input, dec)
+	}
+}
+
+func TestCompressEqual(t *testing.T) {
+	// fastlzgo must produce the same bytes as the cgo FastLZ 0.5.0 encoder
+	rnd := rand.New(rand.NewSource(1))
+	var inputs [][]byte
+	for n := 1; n < 300; n++ {
+		bt := make([]byte, n)
+		rnd.Read(bt)
+		if n%2 == 0 {
+			for i := range bt {
+				bt[i] &= 7
+			}
+		}
+		inputs = append(inputs, bt)
+	}
+	far := make([]byte, 2<<16)
+	rnd.Read(far[:1<<12])
+	copy(far[1<<15:], far[:1<<12])
+	inputs = append(inputs,
+		make([]byte, 2<<16),
+		far,
+		bytes.Repeat([]byte(`{"jsonrpc":"2.0","method":"eth_call","params":[]},`), 2000),
+	)
+
+	for _, input := range inputs {
+		for _, level := range []fastlz.Level{fastlz.Auto, fastlz.Level1, fastlz.Level2} {
+			cenc, err := fastlz.CompressLevel(input, level)
+			require.NoError(t, err)
+			enc, err := fastlzgo.CompressLevel(input, level)
+			require.NoError(t, err)
+			require.Equal(t, cenc, enc, "length %d level %d", len(input), level)
+		}
+
+		cenc, err := fastlz.Compress(input)
+		require.NoError(t, err)
+		require.Equal(t, len(cenc), fastlzgo.CompressedLen(input))
+		require.Equal(t, len(cenc), fastlz.CompressedLen(input))
+		for _, level := range []fastlz.Level{fastlz.Level1, fastlz.Level2} {
+			cenc, err := fastlz.CompressLevel(input, level)
+			require.NoError(t, err)
+			size, err := fastlz.CompressedLenLevel(input, level)
+			require.NoError(t, err)
+			require.Equal(t, len(cenc), size, "length %d level %d", len(input), level)
+		}
+	}
+}
+
+func FuzzCompressEqual(f *testing.F) {
+	f.Add([]byte("hello hello hello hello hello hello"), uint8(1))
+	f.Add(bytes.Repeat([]byte("0123456789abcdef"), 600), uint8(2))
+	f.Fuzz(func(t *testing.T, input []byte, level uint8) {
+		if len(input) == 0 {
+			return
+		}
+		cenc, err := fastlz.CompressLevel(input, fastlz.Level(level%3))
+		require.NoError(t, err)
+		enc, err := fastlzgo.CompressLevel(input, fastlz.Level(level%3))
+		require.NoError(t, err)
+		require.Equal(t, cenc, enc)
+
+		size, err := fastlzgo.CompressedLenLevel(input, fastlz.Level(level%3))
+		require.NoError(t, err)
+		require.Equal(t, len(cenc), size)
+
+		// the cost-aware parse decodes with fastlz_decompress
+		enc, err = fastlzgo.CompressCost(input, fastlzgo.CalldataCost)
+		require.NoError(t, err)
+		dec, err := fastlz.Decompress(enc)
+		require.NoError(t, err)
+		require.Equal(t, input, dec)
+	})
+}
+
+// fuzzSeeds adds real fastlz.Compress output at the given level to the corpus.
+func fuzzSeeds(f *testing.F, level fastlz.Level) {
+	inputs := [][]byte{
+		[]byte("hello world!"),
+		[]byte("hello hello hello hello hello hello"),
+		make([]byte, 300),
+		bytes.Repeat([]byte("0123456789abcdef"), 600),
+		bytes.Repeat([]byte{0xa9, 0x05, 0x9c, 0xbb, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 12),
+	}
+	for _, input := range inputs {
+		enc, err := fastlz.CompressLevel(input, level)
+		require.NoError(f, err)
+		f.Add(enc)
+	}
+}
+
+// fuzzDecompress checks that any block decompresses or fails with an error,
+// and that whatever decompresses also survives a round trip.
+func fuzzDecompress(t *testing.T, data []byte, level fastlz.Level) {
+	if len(data) > 0 {
+		data[0] = data[0]&31 | byte(level-1)<<5
+	}
+	dec, err := fastlzgo.Decompress(data)
+	cdec, cerr := fastlz.Decompress(data)
+	if err != nil {
+		require.Error(t, cerr)
+		return
+	}
+	if cerr == nil {
+		require.Equal(t, dec, cdec)
+	}
+
+	sized, err := fastlzgo.DecompressSize(data, len(dec))
+	require.NoError(t, err)
+	require.Equal(t, dec, sized)
+
+	enc, err := fastlzgo.CompressLevel(dec, level)
+	require.NoError(t, err)
+	again, err := fastlzgo.Decompress(enc)
+	require.NoError(t, err)
+	require.Equal(t, dec, again)
+}
+
+func FuzzDecompressLevel1(f *testing.F) {
+	fuzzSeeds(f, fastlz.Level1)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzDecompress(t, data, fastlz.Level1)
+	})
+}
+
+func FuzzDecompressLevel2(f *testing.F) {
+	fuzzSeeds(f, fastlz.Level2)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzDecompress(t, data, fastlz.Level2)
+	})
+}
+
+func TestOpfee(t *testing.T) {
+	tx := "02f86b0a8084059682f08405968300830186a094" + strings.Repeat("00", 20) + "80b844a9059cbb" + strings.Repeat("00", 68) + "c0"
+	txs := "# raw transactions\n0x" + tx + "\n\n" + strings.Repeat("ab", 200) + "\n"
+
+	raw, err := hex.DecodeString(tx)
+	require.NoError(t, err)
+	enc, err := fastlz.Compress(raw)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	args := []string{"-l1-base-fee", "1000000000", "-blob-base-fee", "10000000", "-base-fee-scalar", "2", "-blob-base-fee-scalar", "3"}
+	require.NoError(t, runOpfee(args, strings.NewReader(txs), &out, io.Discard))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 4)
+	// both transactions are below the regression range: 100 * 32030 wei
+	require.Equal(t, []string{"1", strconv.Itoa(len(raw)), strconv.Itoa(len(enc)), "100", "1600", "3203000"}, strings.Fields(lines[1]))
+	require.Equal(t, []string{"total", "6406000"}, strings.Fields(lines[3]))
+
+	err = runOpfee(nil, strings.NewReader("0xzz\n"), &out, io.Discard)
+	require.Error(t, err)
+}
+
+func TestCLI(t *testing.T) {
+	dir := t.TempDir()
+	text := bytes.Repeat([]byte("hello fastlz cli "), 10000)
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, data, 0o640))
+		return path
+	}
+	run := func(stdin []byte, args ...string) (string, error) {
+		var out bytes.Buffer
+		err := runFastlz(args, bytes.NewReader(stdin), &out, io.Discard)
+		return out.String(), err
+	}
+
+	for _, backend := range codec.Backends() {
+		a := write("a.txt", text)
+
+		// compress in place, then decompress back
+		_, err := run(nil, "-backend", backend, "-2", a)
+		require.NoError(t, err)
+		require.NoFileExists(t, a)
+		enc, err := os.ReadFile(a + ".flz")
+		require.NoError(t, err)
+		dec, err := io.ReadAll(fastlzgo.NewReader(bytes.NewReader(enc)))
+		require.NoError(t, err)
+		require.Equal(t, text, dec)
+
+		out, err := run(nil, "-backend", backend, "-l", a+".flz")
+		require.NoError(t, err)
+		require.Equal(t, []string{strconv.Itoa(len(enc)), strconv.Itoa(len(text))}, strings.Fields(out)[4:6])
+		_, err = run(nil, "-backend", backend, "-t", a+".flz")
+		require.NoError(t, err)
+
+		_, err = run(nil, "-backend", backend, "-d", "-k", a+".flz")
+		require.NoError(t, err)
+		require.FileExists(t, a+".flz")
+		got, err := os.ReadFile(a)
+		require.NoError(t, err)
+		require.Equal(t, text, got)
+		fi, err := os.Stat(a)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o640), fi.Mode().Perm())
+
+		// existing outputs need -f
+		_, err = run(nil, "-backend", backend, "-d", a+".flz")
+		require.ErrorIs(t, err, errFailed)
+		_, err = run(nil, "-backend", backend, "-d", "-f", a+".flz")
+		require.NoError(t, err)
+		require.NoFileExists(t, a+".flz")
+
+		// stdin to stdout
+		out, err = run(text, "-backend", backend)
+		require.NoError(t, err)
+		out, err = run([]byte(out), "-backend", backend, "-d", "-")
+		require.NoError(t, err)
+		require.Equal(t, string(text), out)
+
+		// -c keeps the input
+		out, err = run(nil, "-backend", backend, "-2", "-c", a)
+		require.NoError(t, err)
+		require.FileExists(t, a)
+		require.Equal(t, enc, []byte(out))
+		require.NoError(t, os.Remove(a))
+	}
+
+	// recursive mode skips files that are already compressed
+	b := write("sub/b.txt", text)
+	c := write("sub/deeper/c.txt", []byte("c"))
+	write("sub/deeper/d.flz", nil)
+	_, err := run(nil, "-r", filepath.Join(dir, "sub"))
+	require.ErrorIs(t, err, errFailed)
+	require.FileExists(t, b+".flz")
+	require.FileExists(t, c+".flz")
+	out, err := run(nil, "-l", b+".flz", c+".flz")
+	require.NoError(t, err)
+	require.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 4)
+	_, err = run(nil, "-d", "-r", filepath.Join(dir, "sub"))
+	require.ErrorIs(t, err, errFailed) // d.flz is empty
+	got, err := os.ReadFile(b)
+	require.NoError(t, err)
+	require.Equal(t, text, got)
+
+	_, err = run(nil, "-t", write("bad.flz", []byte("not fastlz")))
+	require.ErrorIs(t, err, errFailed)
+	_, err = run(nil, "-d", write("e.txt", text))
+	require.ErrorIs(t, err, errFailed)
+	_, err = run(nil, filepath.Join(dir, "sub"))
+	require.ErrorIs(t, err, errFailed)
+	_, err = run(nil, "-1", "-2")
+	require.Error(t, err)
+	_, err = run(nil, "-backend", "zstd")
+	require.Error(t, err)
 }
 
 func BenchmarkCompress(b *testing.B) {
@@ -74,3 +360,25 @@ func BenchmarkCompress(b *testing.B) {
 		b.SetBytes(int64(len(bt)))
 	})
 }
+
+func BenchmarkCompressedLen(b *testing.B) {
+	bt := bytes.Repeat([]byte{0xa9, 0x05, 0x9c, 0xbb, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3}, 32)
+
+	b.Run("fastlz cgo len(Compress) [Length 2<<8]", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			enc, err := fastlz.Compress(bt)
+			require.NoError(b, err)
+			_ = len(enc)
+		}
+		b.SetBytes(int64(len(bt)))
+	})
+
+	b.Run("fastlz  go CompressedLen [Length 2<<8]", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = fastlzgo.CompressedLen(bt)
+		}
+		b.SetBytes(int64(len(bt)))
+	})
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rabbitprincess/fastlz-go/opfee"
+)
+
+// runOpfee estimates Fjord L1 data fees for a file of hex encoded raw
+// transactions, one per line.
+func runOpfee(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("opfee", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: fastlz opfee [flags] [file]")
+		fmt.Fprintln(stderr, "Reads hex encoded raw transactions, one per line, from file or stdin.")
+		fs.PrintDefaults()
+	}
+	l1BaseFee := fs.String("l1-base-fee", "0", "L1 base fee in wei")
+	blobBaseFee := fs.String("blob-base-fee", "0", "L1 blob base fee in wei")
+	baseFeeScalar := fs.Uint("base-fee-scalar", 0, "base fee scalar")
+	blobBaseFeeScalar := fs.Uint("blob-base-fee-scalar", 0, "blob base fee scalar")
+	unsigned := fs.Bool("unsigned", false, "transactions are unsigned, pad them like GasPriceOracle.getL1Fee")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	p := opfee.Params{
+		L1BaseFee:         new(big.Int),
+		BlobBaseFee:       new(big.Int),
+		BaseFeeScalar:     uint32(*baseFeeScalar),
+		BlobBaseFeeScalar: uint32(*blobBaseFeeScalar),
+	}
+	if _, ok := p.L1BaseFee.SetString(*l1BaseFee, 10); !ok {
+		return fmt.Errorf("invalid l1 base fee %q", *l1BaseFee)
+	}
+	if _, ok := p.BlobBaseFee.SetString(*blobBaseFee, 10); !ok {
+		return fmt.Errorf("invalid blob base fee %q", *blobBaseFee)
+	}
+
+	in := stdin
+	if name := fs.Arg(0); name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "tx\tsize\tfastlz\testimated\tl1 gas\tl1 fee\t")
+
+	total := new(big.Int)
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(nil, 1<<26)
+	for n := 1; scanner.Scan(); {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tx, err := hex.DecodeString(strings.TrimPrefix(line, "0x"))
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", n, err)
+		}
+
+		var fee opfee.Fee
+		if *unsigned {
+			fee = opfee.Estimate(tx, p)
+		} else {
+			fee = opfee.EstimateSigned(tx, p)
+		}
+		total.Add(total, fee.L1Fee)
+
+		estimated := new(big.Int).Div(fee.EstimatedSizeScaled, big.NewInt(1e6))
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%s\t%s\t\n", n, len(tx), fee.FastLZSize, estimated, fee.L1GasUsed, fee.L1Fee)
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "total\t\t\t\t\t%s\t\n", total)
+	return w.Flush()
+}
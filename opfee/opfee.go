@@ -0,0 +1,119 @@
+// Package opfee estimates OP Stack L1 data fees with the Fjord cost function,
+// which is driven by the FastLZ compressed size of a transaction.
+//
+//	l1FeeScaled   = baseFeeScalar*l1BaseFee*16 + blobBaseFeeScalar*blobBaseFee
+//	estimatedSize = max(minTransactionSize*1e6, intercept + fastlzCoef*fastlzSize)
+//	l1Fee         = estimatedSize * l1FeeScaled / 1e12
+package opfee
+
+import (
+	"math/big"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+)
+
+// Fjord cost function constants, as in the GasPriceOracle predeploy.
+const (
+	L1CostIntercept          = -42_585_600
+	L1CostFastlzCoef         = 836_500
+	MinTransactionSize       = 100
+	MinTransactionSizeScaled = MinTransactionSize * 1e6
+
+	// SignaturePadding is added to the FastLZ size of an unsigned transaction
+	// to account for its missing signature.
+	SignaturePadding = 68
+
+	// TxDataNonZeroGas is the calldata gas of a non-zero byte (EIP-2028).
+	TxDataNonZeroGas = 16
+)
+
+var (
+	fjordDivisor = big.NewInt(1e12)
+	scaleDivisor = big.NewInt(1e6)
+)
+
+// Params are the L1 fee parameters of the L1Block predeploy.
+type Params struct {
+	L1BaseFee         *big.Int
+	BlobBaseFee       *big.Int
+	BaseFeeScalar     uint32
+	BlobBaseFeeScalar uint32
+}
+
+// Fee is the L1 data fee breakdown of a transaction.
+type Fee struct {
+	FastLZSize          uint64   // FastLZ size fed into the regression
+	EstimatedSizeScaled *big.Int // estimated compressed size, scaled by 1e6
+	L1FeeScaled         *big.Int // L1 fee per byte, scaled by 1e6
+	L1Fee               *big.Int // L1 data fee in wei
+	L1GasUsed           *big.Int // L1 gas used, as reported in receipts
+}
+
+// FlzCompressLen returns the FastLZ compressed length of data, the same
+// value as LibZip.flzCompress(data).length.
+func FlzCompressLen(data []byte) uint64 {
+	size, _ := fastlzgo.CompressedLenLevel(data, fastlzgo.Level1)
+	return uint64(size)
+}
+
+// Estimate returns the L1 fee of an unsigned transaction the way
+// GasPriceOracle.getL1Fee does, adding SignaturePadding to its FastLZ size.
+func Estimate(unsignedTx []byte, p Params) Fee {
+	return FeeForSize(FlzCompressLen(unsignedTx)+SignaturePadding, p)
+}
+
+// EstimateSigned returns the L1 fee of a signed transaction the way the
+// execution engine charges it, from the FastLZ size of the full transaction.
+func EstimateSigned(signedTx []byte, p Params) Fee {
+	return FeeForSize(FlzCompressLen(signedTx), p)
+}
+
+// UpperBound returns the L1 fee upper bound of an unsigned transaction of
+// the given size, as GasPriceOracle.getL1FeeUpperBound computes it.
+func UpperBound(unsignedTxSize uint64, p Params) Fee {
+	txSize := unsignedTxSize + SignaturePadding
+	return FeeForSize(txSize+txSize/255+16, p)
+}
+
+// EstimatedSizeScaled applies the Fjord linear regression to a FastLZ size.
+// The result is the estimated compressed size scaled by 1e6.
+func EstimatedSizeScaled(fastLZSize uint64) *big.Int {
+	size := new(big.Int).SetUint64(fastLZSize)
+	size.Mul(size, big.NewInt(L1CostFastlzCoef))
+	size.Add(size, big.NewInt(L1CostIntercept))
+	if size.Cmp(big.NewInt(MinTransactionSizeScaled)) < 0 {
+		size.SetInt64(MinTransactionSizeScaled)
+	}
+	return size
+}
+
+// FeeForSize returns the L1 fee for a transaction with the given FastLZ size.
+func FeeForSize(fastLZSize uint64, p Params) Fee {
+	l1FeeScaled := new(big.Int).SetUint64(uint64(p.BaseFeeScalar))
+	l1FeeScaled.Mul(l1FeeScaled, bigOrZero(p.L1BaseFee))
+	l1FeeScaled.Mul(l1FeeScaled, big.NewInt(TxDataNonZeroGas))
+	blobFeeScaled := new(big.Int).SetUint64(uint64(p.BlobBaseFeeScalar))
+	blobFeeScaled.Mul(blobFeeScaled, bigOrZero(p.BlobBaseFee))
+	l1FeeScaled.Add(l1FeeScaled, blobFeeScaled)
+
+	size := EstimatedSizeScaled(fastLZSize)
+	l1Fee := new(big.Int).Mul(size, l1FeeScaled)
+	l1Fee.Div(l1Fee, fjordDivisor)
+	l1GasUsed := new(big.Int).Mul(size, big.NewInt(TxDataNonZeroGas))
+	l1GasUsed.Div(l1GasUsed, scaleDivisor)
+
+	return Fee{
+		FastLZSize:          fastLZSize,
+		EstimatedSizeScaled: size,
+		L1FeeScaled:         l1FeeScaled,
+		L1Fee:               l1Fee,
+		L1GasUsed:           l1GasUsed,
+	}
+}
+
+func bigOrZero(x *big.Int) *big.Int {
+	if x == nil {
+		return new(big.Int)
+	}
+	return x
+}
@@ -0,0 +1,67 @@
+package opfee
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeeForSize(t *testing.T) {
+	// parameters of the op-geth Fjord cost function tests
+	gethParams := Params{
+		L1BaseFee:         big.NewInt(1000 * 1e6),
+		BlobBaseFee:       big.NewInt(10 * 1e6),
+		BaseFeeScalar:     2,
+		BlobBaseFeeScalar: 3,
+	}
+	// OP Mainnet scalars with a 30 gwei L1 base fee and a 1 wei blob base fee
+	mainnetParams := Params{
+		L1BaseFee:         big.NewInt(30e9),
+		BlobBaseFee:       big.NewInt(1),
+		BaseFeeScalar:     5227,
+		BlobBaseFeeScalar: 1014213,
+	}
+
+	tests := []struct {
+		name       string
+		fastLZSize uint64
+		params     Params
+		size       int64
+		fee        int64
+		gasUsed    int64
+	}{
+		// below the regression range, the minimum transaction size applies
+		{"minimum size", 0, gethParams, 100_000_000, 3_203_000, 1600},
+		{"below regression", 100, gethParams, 100_000_000, 3_203_000, 1600},
+		{"regression", 1000, gethParams, 793_914_400, 25_429_078, 12702},
+		{"large", 5000, gethParams, 4_139_914_400, 132_601_458, 66238},
+		{"mainnet transfer", 171, mainnetParams, 100_455_900, 252_039_834_965, 1607},
+		{"mainnet regression", 1000, mainnetParams, 793_914_400, 1_991_899_473_829, 12702},
+		{"zero fees", 1000, Params{}, 793_914_400, 0, 12702},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fee := FeeForSize(tt.fastLZSize, tt.params)
+			require.Equal(t, tt.fastLZSize, fee.FastLZSize)
+			require.Equal(t, big.NewInt(tt.size), fee.EstimatedSizeScaled)
+			require.Equal(t, big.NewInt(tt.fee), fee.L1Fee)
+			require.Equal(t, big.NewInt(tt.gasUsed), fee.L1GasUsed)
+		})
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	p := Params{L1BaseFee: big.NewInt(30e9), BlobBaseFee: big.NewInt(1), BaseFeeScalar: 5227, BlobBaseFeeScalar: 1014213}
+	tx := bytes.Repeat([]byte{0xa9, 0x05, 0x9c, 0xbb, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 4}, 40)
+
+	flzLen := FlzCompressLen(tx)
+	require.Less(t, flzLen, uint64(len(tx)))
+	require.Equal(t, flzLen+SignaturePadding, Estimate(tx, p).FastLZSize)
+	require.Equal(t, flzLen, EstimateSigned(tx, p).FastLZSize)
+
+	// txSize = 200 + 68, upper bound = 268 + 268/255 + 16
+	require.Equal(t, uint64(285), UpperBound(200, p).FastLZSize)
+	require.Zero(t, FlzCompressLen(nil))
+}
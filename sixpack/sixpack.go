@@ -0,0 +1,466 @@
+// Package sixpack reads and writes the archives of 6pack, the archiver that
+// ships with FastLZ.
+//
+// An archive is an 8-byte magic followed by chunks. Every chunk has a 16-byte
+// header of little endian integers: id (2 bytes), options (2), size of the
+// chunk data (4), Adler-32 of the chunk data (4) and an extra value (4).
+// A file entry chunk (id 1) holds the file size (8 bytes), the length of the
+// name including its NUL terminator (2) and the name. The data chunks (id 17)
+// that follow hold the file in pieces of up to 128 KiB, stored (options 0)
+// or as a FastLZ block (options 1), with the original size in extra. Other
+// chunks are skipped, as 6unpack does.
+package sixpack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"io"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+)
+
+// Magic starts every 6pack archive.
+var Magic = [8]byte{137, '6', 'P', 'K', 13, 10, 26, 10}
+
+// BlockSize is the largest original size of a data chunk written by 6pack.
+const BlockSize = 2 * 64 * 1024
+
+const (
+	chunkHeaderSize = 16
+	chunkFileEntry  = 1
+	chunkData       = 17
+
+	optionStored   = 0
+	optionCompress = 1
+
+	/* 6pack stores blocks of fewer bytes without compressing them */
+	minCompressSize = 32
+
+	/* larger chunks are rejected rather than allocated */
+	maxChunkSize = 64 << 20
+)
+
+var (
+	// ErrNotArchive is returned by NewReader when the input does not start
+	// with Magic.
+	ErrNotArchive = errors.New("not a 6pack archive")
+	// ErrChecksum is returned when a chunk does not match its Adler-32.
+	ErrChecksum = fastlzgo.ErrChecksum
+	// ErrCorrupt is returned for chunks that can not be decoded.
+	ErrCorrupt = fastlzgo.ErrCorrupt
+	// ErrTooLarge is returned for a file passing the limit set with
+	// WithMaxDecodedSize.
+	ErrTooLarge = fastlzgo.ErrTooLarge
+)
+
+// File describes a file in an archive.
+type File struct {
+	Name string
+	Size int64
+}
+
+type chunkHeader struct {
+	id, options uint16
+	size        uint32
+	checksum    uint32
+	extra       uint32
+}
+
+func (h *chunkHeader) append(dst []byte) []byte {
+	dst = binary.LittleEndian.AppendUint16(dst, h.id)
+	dst = binary.LittleEndian.AppendUint16(dst, h.options)
+	dst = binary.LittleEndian.AppendUint32(dst, h.size)
+	dst = binary.LittleEndian.AppendUint32(dst, h.checksum)
+	return binary.LittleEndian.AppendUint32(dst, h.extra)
+}
+
+func parseChunkHeader(b []byte) chunkHeader {
+	return chunkHeader{
+		id:       binary.LittleEndian.Uint16(b),
+		options:  binary.LittleEndian.Uint16(b[2:]),
+		size:     binary.LittleEndian.Uint32(b[4:]),
+		checksum: binary.LittleEndian.Uint32(b[8:]),
+		extra:    binary.LittleEndian.Uint32(b[12:]),
+	}
+}
+
+// Writer writes a 6pack archive. The output is byte-for-byte what 6pack
+// writes for the same files at the same level.
+type Writer struct {
+	w     io.Writer
+	level fastlzgo.Level
+
+	wroteMagic bool
+	file       *File
+	written    int64 /* bytes written to the current file */
+	buf        []byte
+	out        []byte
+	err        error
+}
+
+// NewWriter returns a Writer compressing at level 2, the default of 6pack.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w, level: fastlzgo.Level2}
+}
+
+// NewWriterLevel returns a Writer compressing at level 1 or 2.
+func NewWriterLevel(w io.Writer, level fastlzgo.Level) (*Writer, error) {
+	if level != fastlzgo.Level1 && level != fastlzgo.Level2 {
+		return nil, fastlzgo.ErrUnknownLevel
+	}
+	return &Writer{w: w, level: level}, nil
+}
+
+// Create adds a file to the archive and returns a writer for its contents.
+// The file entry records the size before the data, so exactly size bytes
+// must be written before the next call to Create or Close.
+//
+// 6pack stores the base name of the files it packs; name is stored as is.
+func (w *Writer) Create(name string, size int64) (io.Writer, error) {
+	if err := w.closeFile(); err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("negative size %d for %s", size, name)
+	}
+	if len(name)+1 > 0xffff || len(name)+1 >= BlockSize-10 || bytes.IndexByte([]byte(name), 0) >= 0 {
+		return nil, fmt.Errorf("invalid file name %q", name)
+	}
+
+	if err := w.writeMagic(); err != nil {
+		return nil, err
+	}
+
+	entry := binary.LittleEndian.AppendUint64(nil, uint64(size))
+	entry = binary.LittleEndian.AppendUint16(entry, uint16(len(name)+1))
+	entry = append(entry, name...)
+	entry = append(entry, 0)
+	if err := w.writeChunk(chunkHeader{id: chunkFileEntry}, entry); err != nil {
+		return nil, err
+	}
+
+	w.file = &File{Name: name, Size: size}
+	w.written = 0
+	return fileWriter{w}, nil
+}
+
+// Close finishes the last file. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if err := w.writeMagic(); err != nil {
+		return err
+	}
+	return w.closeFile()
+}
+
+func (w *Writer) writeMagic() error {
+	if w.wroteMagic {
+		return nil
+	}
+	if err := w.write(Magic[:]); err != nil {
+		return err
+	}
+	w.wroteMagic = true
+	return nil
+}
+
+type fileWriter struct{ w *Writer }
+
+func (f fileWriter) Write(p []byte) (int, error) {
+	w := f.w
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.file == nil {
+		return 0, errors.New("write to a closed file")
+	}
+	if int64(len(p)) > w.file.Size-w.written {
+		return 0, fmt.Errorf("write exceeds the size of %s", w.file.Name)
+	}
+
+	n := 0
+	for len(p) > 0 {
+		k := min(len(p), BlockSize-len(w.buf))
+		w.buf = append(w.buf, p[:k]...)
+		p = p[k:]
+		n += k
+		w.written += int64(k)
+		if len(w.buf) == BlockSize {
+			if err := w.writeBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+func (w *Writer) closeFile() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.file == nil {
+		return nil
+	}
+	if w.written != w.file.Size {
+		return fmt.Errorf("%s: wrote %d bytes, expected %d", w.file.Name, w.written, w.file.Size)
+	}
+	w.file = nil
+	if len(w.buf) == 0 {
+		return nil
+	}
+	return w.writeBlock()
+}
+
+// writeBlock writes the buffered data as a data chunk.
+func (w *Writer) writeBlock() error {
+	block := w.buf
+	w.buf = w.buf[:0]
+
+	h := chunkHeader{id: chunkData, options: optionStored, extra: uint32(len(block))}
+	data := block
+	if len(block) >= minCompressSize {
+		bound := fastlzgo.CompressBound(len(block))
+		if len(w.out) < bound {
+			w.out = make([]byte, bound)
+		}
+		size, err := fastlzgo.CompressLevelInto(w.out, block, w.level)
+		if err != nil {
+			return err
+		}
+		h.options = optionCompress
+		data = w.out[:size]
+	}
+	return w.writeChunk(h, data)
+}
+
+func (w *Writer) writeChunk(h chunkHeader, data []byte) error {
+	h.size = uint32(len(data))
+	h.checksum = adler32.Checksum(data)
+	if err := w.write(h.append(make([]byte, 0, chunkHeaderSize))); err != nil {
+		return err
+	}
+	return w.write(data)
+}
+
+func (w *Writer) write(p []byte) error {
+	if _, err := w.w.Write(p); err != nil {
+		w.err = err
+		return err
+	}
+	return nil
+}
+
+// Reader reads the files of a 6pack archive in order. Next moves to the next
+// file and Read reads its contents.
+type Reader struct {
+	r io.Reader
+
+	maxDecoded int64
+	decoded    int64 /* sizes of the files returned by Next */
+
+	file      *File
+	remaining int64 /* bytes of the current file not decoded yet */
+	buf       []byte
+	out       []byte
+	pos       int
+	err       error
+}
+
+// ReaderOption configures a Reader.
+type ReaderOption func(*Reader)
+
+// WithMaxDecodedSize limits the total size of the files in an archive to n
+// bytes. Next fails with ErrTooLarge for a file that would pass
+// the limit, before any of its data is read. n <= 0 means no limit, the
+// default.
+func WithMaxDecodedSize(n int64) ReaderOption {
+	return func(r *Reader) {
+		r.maxDecoded = n
+	}
+}
+
+// NewReader returns a Reader for the archive in r. It reads the magic.
+func NewReader(r io.Reader, opts ...ReaderOption) (*Reader, error) {
+	var magic [8]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotArchive
+		}
+		return nil, err
+	}
+	if magic != Magic {
+		return nil, ErrNotArchive
+	}
+	zr := &Reader{r: r}
+	for _, opt := range opts {
+		opt(zr)
+	}
+	return zr, nil
+}
+
+// Next skips the rest of the current file and returns the next one. It
+// returns io.EOF at the end of the archive.
+func (r *Reader) Next() (*File, error) {
+	for r.file != nil {
+		if _, err := io.Copy(io.Discard, r); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	for {
+		h, err := r.readChunkHeader()
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+		data, err := r.readChunk(h)
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+		/* data chunks before the first file are skipped, as 6unpack does */
+		if h.id != chunkFileEntry {
+			continue
+		}
+
+		if len(data) <= 10 || len(data) >= BlockSize {
+			r.err = fmt.Errorf("%w: file entry of %d bytes", ErrCorrupt, len(data))
+			return nil, r.err
+		}
+		size := binary.LittleEndian.Uint64(data)
+		nameLen := min(int(binary.LittleEndian.Uint16(data[8:])), len(data)-10)
+		name, _, _ := bytes.Cut(data[10:10+nameLen], []byte{0})
+		if size > 1<<62 {
+			r.err = fmt.Errorf("%w: file size %d", ErrCorrupt, size)
+			return nil, r.err
+		}
+		if r.maxDecoded > 0 && int64(size) > r.maxDecoded-r.decoded {
+			r.err = fmt.Errorf("%s: %w", name, ErrTooLarge)
+			return nil, r.err
+		}
+		r.decoded += int64(size)
+
+		r.file = &File{Name: string(name), Size: int64(size)}
+		r.remaining = int64(size)
+		r.out = r.out[:0]
+		r.pos = 0
+		return r.file, nil
+	}
+}
+
+// Read reads the contents of the current file. It returns io.EOF at the end
+// of the file.
+func (r *Reader) Read(p []byte) (int, error) {
+	for r.pos == len(r.out) {
+		if r.file == nil {
+			return 0, io.EOF
+		}
+		if r.remaining == 0 {
+			r.file = nil
+			return 0, io.EOF
+		}
+		if r.err != nil {
+			return 0, r.err
+		}
+		if err := r.readData(); err != nil {
+			r.err = err
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.out[r.pos:])
+	r.pos += n
+	return n, nil
+}
+
+// readData decodes the next data chunk of the current file.
+func (r *Reader) readData() error {
+	for {
+		h, err := r.readChunkHeader()
+		if err == io.EOF {
+			return fmt.Errorf("%s: %w", r.file.Name, io.ErrUnexpectedEOF)
+		}
+		if err != nil {
+			return err
+		}
+		if h.id == chunkFileEntry {
+			return fmt.Errorf("%w: %s ends %d bytes early", ErrCorrupt, r.file.Name, r.remaining)
+		}
+		data, err := r.readChunk(h)
+		if err != nil {
+			return err
+		}
+		if h.id != chunkData {
+			continue
+		}
+
+		switch h.options {
+		case optionStored:
+			r.out = append(r.out[:0], data...)
+		case optionCompress:
+			/* checked before allocating, the file size is within the limit */
+			if int64(h.extra) > r.remaining {
+				return fmt.Errorf("%w: %s is longer than %d bytes", ErrCorrupt, r.file.Name, r.file.Size)
+			}
+			if h.extra > maxChunkSize {
+				return fmt.Errorf("%w: chunk of %d bytes", ErrCorrupt, h.extra)
+			}
+			if cap(r.out) < int(h.extra) {
+				r.out = make([]byte, h.extra)
+			}
+			r.out = r.out[:h.extra]
+			size, err := fastlzgo.DecompressInto(r.out, data)
+			if err != nil {
+				return err
+			}
+			if size != int(h.extra) {
+				return fmt.Errorf("%w: decompressed %d bytes, expected %d", ErrCorrupt, size, h.extra)
+			}
+		default:
+			return fmt.Errorf("%w: unknown compression method %d", ErrCorrupt, h.options)
+		}
+
+		if int64(len(r.out)) > r.remaining {
+			return fmt.Errorf("%w: %s is longer than %d bytes", ErrCorrupt, r.file.Name, r.file.Size)
+		}
+		r.remaining -= int64(len(r.out))
+		r.pos = 0
+		return nil
+	}
+}
+
+// readChunkHeader reads the next chunk header, or returns io.EOF at the end
+// of the archive.
+func (r *Reader) readChunkHeader() (chunkHeader, error) {
+	var hdr [chunkHeaderSize]byte
+	if _, err := io.ReadFull(r.r, hdr[:]); err != nil {
+		return chunkHeader{}, err
+	}
+	return parseChunkHeader(hdr[:]), nil
+}
+
+// readChunk reads the chunk data and verifies its checksum.
+func (r *Reader) readChunk(h chunkHeader) ([]byte, error) {
+	if h.size > maxChunkSize {
+		return nil, fmt.Errorf("%w: chunk of %d bytes", ErrCorrupt, h.size)
+	}
+	if cap(r.buf) < int(h.size) {
+		r.buf = make([]byte, h.size)
+	}
+	data := r.buf[:h.size]
+	if _, err := io.ReadFull(r.r, data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if adler32.Checksum(data) != h.checksum {
+		return nil, ErrChecksum
+	}
+	return data, nil
+}
@@ -0,0 +1,205 @@
+package sixpack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rabbitprincess/fastlz-go/fastlzgo"
+	"github.com/stretchr/testify/require"
+)
+
+// readInput returns a file packed into the fixtures.
+func readInput(t *testing.T, name string) []byte {
+	if name == "seq.txt" {
+		var b strings.Builder
+		for i := 1; i <= 25000; i++ {
+			fmt.Fprintln(&b, i)
+		}
+		return []byte(b.String())
+	}
+	data, err := os.ReadFile("testdata/in/" + name)
+	require.NoError(t, err)
+	return data
+}
+
+func readAll(t *testing.T, archive []byte) ([]string, [][]byte) {
+	r, err := NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+
+	var names []string
+	var files [][]byte
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			return names, files
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, f.Size, int64(len(data)))
+		names = append(names, f.Name)
+		files = append(files, data)
+	}
+}
+
+// The archives in testdata were written by gen6pack.c, a transcription of
+// the chunk writer of 6pack, and the ones in testdata/upstream by the 6pack
+// tool built from the upstream repository with gen-upstream.sh.
+var fixtures = []struct {
+	archive string
+	level   fastlzgo.Level
+	files   []string
+}{
+	{"hello.6pk", fastlzgo.Level2, []string{"hello.txt"}},
+	{"seq.6pk", fastlzgo.Level2, []string{"seq.txt"}},
+	{"seq-level1.6pk", fastlzgo.Level1, []string{"seq.txt"}},
+	{"multi.6pk", fastlzgo.Level2, []string{"hello.txt", "seq.txt", "empty.txt", "lcg.bin"}},
+}
+
+func TestFixtures(t *testing.T) {
+	for _, tt := range fixtures {
+		checkFixture(t, "testdata/"+tt.archive, tt.level, tt.files)
+	}
+}
+
+func TestUpstreamFixtures(t *testing.T) {
+	version, err := os.ReadFile("testdata/upstream/UPSTREAM")
+	if os.IsNotExist(err) {
+		t.Skip("no archives from upstream 6pack committed, run testdata/gen-upstream.sh")
+	}
+	require.NoError(t, err)
+	t.Logf("FastLZ %s", strings.TrimSpace(string(version)))
+
+	// upstream 6pack writes one file per archive
+	for _, tt := range fixtures[:3] {
+		checkFixture(t, "testdata/upstream/"+tt.archive, tt.level, tt.files)
+	}
+}
+
+// checkFixture checks that the archive holds files and that Writer packs
+// them into the same bytes.
+func checkFixture(t *testing.T, path string, level fastlzgo.Level, files []string) {
+	archive, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	names, data := readAll(t, archive)
+	require.Equal(t, files, names)
+
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, level)
+	require.NoError(t, err)
+	for i, name := range files {
+		input := readInput(t, name)
+		require.Equal(t, input, data[i])
+
+		fw, err := w.Create(name, int64(len(input)))
+		require.NoError(t, err)
+		_, err = fw.Write(input)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.Equal(t, archive, buf.Bytes(), path)
+}
+
+func TestWriter(t *testing.T) {
+	text := bytes.Repeat([]byte("hello 6pack "), 50000)
+
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	fw, err := w.Create("text", int64(len(text)))
+	require.NoError(t, err)
+	// small writes are gathered into 128 KiB chunks
+	for p := text; len(p) > 0; p = p[min(len(p), 1000):] {
+		_, err := fw.Write(p[:min(len(p), 1000)])
+		require.NoError(t, err)
+	}
+	_, err = w.Create("short", 10)
+	require.NoError(t, err)
+	_, err = w.Create("next", 0)
+	require.Error(t, err)
+
+	buf.Reset()
+	w = NewWriter(&buf)
+	require.NoError(t, w.Close())
+	require.Equal(t, Magic[:], buf.Bytes())
+	names, _ := readAll(t, buf.Bytes())
+	require.Empty(t, names)
+
+	w = NewWriter(&buf)
+	fw, err = w.Create("a", 3)
+	require.NoError(t, err)
+	_, err = fw.Write([]byte("abcd"))
+	require.Error(t, err)
+	_, err = w.Create("a\x00b", 3)
+	require.Error(t, err)
+
+	_, err = NewWriterLevel(&buf, fastlzgo.Auto)
+	require.ErrorIs(t, err, fastlzgo.ErrUnknownLevel)
+}
+
+func TestReaderErrors(t *testing.T) {
+	archive, err := os.ReadFile("testdata/multi.6pk")
+	require.NoError(t, err)
+
+	read := func(archive []byte) error {
+		r, err := NewReader(bytes.NewReader(archive))
+		if err != nil {
+			return err
+		}
+		for {
+			if _, err := r.Next(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	require.NoError(t, read(archive))
+
+	_, err = NewReader(strings.NewReader("PK\x03\x04"))
+	require.ErrorIs(t, err, ErrNotArchive)
+
+	bad := bytes.Clone(archive)
+	bad[len(bad)-1] ^= 1
+	require.ErrorIs(t, read(bad), ErrChecksum)
+
+	bad = bytes.Clone(archive)
+	bad[len(Magic)+2] = 5 // unknown method of the first file entry is ignored
+	require.NoError(t, read(bad))
+
+	// the data chunk of hello.txt, stored, gets an unknown method
+	bad = bytes.Clone(archive)
+	bad[len(Magic)+16+20+2] = 9
+	require.ErrorIs(t, read(bad), ErrCorrupt)
+
+	// the limit covers the files of the whole archive
+	limited := func(limit int64) error {
+		r, err := NewReader(bytes.NewReader(archive), WithMaxDecodedSize(limit))
+		require.NoError(t, err)
+		for {
+			if _, err := r.Next(); err != nil {
+				if err == io.EOF {
+					return nil
+				}
+				return err
+			}
+		}
+	}
+	var total int64
+	r, err := NewReader(bytes.NewReader(archive))
+	require.NoError(t, err)
+	for f, err := r.Next(); err != io.EOF; f, err = r.Next() {
+		require.NoError(t, err)
+		total += f.Size
+	}
+	require.NoError(t, limited(total))
+	require.ErrorIs(t, limited(total-1), ErrTooLarge)
+
+	require.ErrorIs(t, read(archive[:len(archive)-1]), io.ErrUnexpectedEOF)
+	require.ErrorIs(t, read(archive[:len(Magic)+10]), io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,24 @@
+#!/bin/sh
+# Writes upstream/hello.6pk, upstream/seq.6pk and upstream/seq-level1.6pk
+# with the 6pack example of the upstream FastLZ repository. FASTLZ_REF
+# selects the tag or commit; the version used is recorded in
+# upstream/UPSTREAM. 6pack packs one file per archive, so there is no
+# upstream multi.6pk.
+set -eu
+cd "$(dirname "$0")"
+rm -rf fastlz-upstream
+git clone -q https://github.com/ariya/FastLZ fastlz-upstream
+git -C fastlz-upstream checkout -q "${FASTLZ_REF:-0.5.0}"
+cc -O2 -I fastlz-upstream -o 6pack fastlz-upstream/examples/6pack.c fastlz-upstream/fastlz.c
+
+seq 1 25000 > in/seq.txt
+rm -rf upstream
+mkdir upstream
+# 6pack stores the name it is given, so pack from in/
+(cd in && ../6pack hello.txt ../upstream/hello.6pk && ../6pack seq.txt ../upstream/seq.6pk && ../6pack -1 seq.txt ../upstream/seq-level1.6pk)
+
+{
+	echo "ref $(git -C fastlz-upstream describe --tags --always)"
+	echo "commit $(git -C fastlz-upstream rev-parse HEAD)"
+} > upstream/UPSTREAM
+rm -rf fastlz-upstream 6pack
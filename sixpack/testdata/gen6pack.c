@@ -0,0 +1,170 @@
+/*
+  Writes the 6pack fixtures in this directory.
+
+  The chunk writing below is pack_file_compressed from examples/6pack.c of
+  FastLZ 0.5.0, with the progress output removed and the output file passed
+  in, so that several files can be packed into one archive. It links the
+  fastlz.c vendored by the cgo package:
+
+    cc -O2 -I../../fastlz -o gen6pack gen6pack.c ../../fastlz/fastlz.c
+    ./gen6pack
+*/
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#include "fastlz.h"
+
+#define BLOCK_SIZE (2 * 64 * 1024)
+
+static unsigned char sixpack_magic[8] = {137, '6', 'P', 'K', 13, 10, 26, 10};
+
+#define ADLER32_BASE 65521
+
+static unsigned long update_adler32(unsigned long checksum, const void* buf, int len) {
+  const unsigned char* ptr = (const unsigned char*)buf;
+  unsigned long s1 = checksum & 0xffff;
+  unsigned long s2 = (checksum >> 16) & 0xffff;
+
+  while (len > 0) {
+    unsigned k = len < 5552 ? len : 5552;
+    len -= k;
+    while (k--) {
+      s1 += *ptr++;
+      s2 += s1;
+    }
+    s1 = s1 % ADLER32_BASE;
+    s2 = s2 % ADLER32_BASE;
+  }
+  return (s2 << 16) + s1;
+}
+
+static void write_magic(FILE* f) { fwrite(sixpack_magic, 8, 1, f); }
+
+static void write_chunk_header(FILE* f, int id, int options, unsigned long size, unsigned long checksum,
+                               unsigned long extra) {
+  unsigned char buffer[16];
+
+  buffer[0] = id & 255;
+  buffer[1] = id >> 8;
+  buffer[2] = options & 255;
+  buffer[3] = options >> 8;
+  buffer[4] = size & 255;
+  buffer[5] = (size >> 8) & 255;
+  buffer[6] = (size >> 16) & 255;
+  buffer[7] = (size >> 24) & 255;
+  buffer[8] = checksum & 255;
+  buffer[9] = (checksum >> 8) & 255;
+  buffer[10] = (checksum >> 16) & 255;
+  buffer[11] = (checksum >> 24) & 255;
+  buffer[12] = extra & 255;
+  buffer[13] = (extra >> 8) & 255;
+  buffer[14] = (extra >> 16) & 255;
+  buffer[15] = (extra >> 24) & 255;
+
+  fwrite(buffer, 16, 1, f);
+}
+
+static int pack_file_compressed(const char* input_file, int method, int level, FILE* f) {
+  FILE* in;
+  unsigned long fsize;
+  unsigned long checksum;
+  const char* shown_name;
+  unsigned char buffer[BLOCK_SIZE];
+  unsigned char result[BLOCK_SIZE * 2]; /* FIXME twice is too large */
+  unsigned long chunk_size;
+
+  in = fopen(input_file, "rb");
+  if (!in) {
+    printf("Error: could not open %s\n", input_file);
+    return -1;
+  }
+
+  /* find size of the file */
+  fseek(in, 0, SEEK_END);
+  fsize = ftell(in);
+  fseek(in, 0, SEEK_SET);
+
+  /* truncate directory prefix, e.g. "foo/bar/FILE.txt" becomes "FILE.txt" */
+  shown_name = input_file + strlen(input_file) - 1;
+  while (shown_name > input_file)
+    if (*(shown_name - 1) == '/')
+      break;
+    else
+      shown_name--;
+
+  /* chunk for File Entry */
+  buffer[0] = fsize & 255;
+  buffer[1] = (fsize >> 8) & 255;
+  buffer[2] = (fsize >> 16) & 255;
+  buffer[3] = (fsize >> 24) & 255;
+  buffer[4] = 0;
+  buffer[5] = 0;
+  buffer[6] = 0;
+  buffer[7] = 0;
+  buffer[8] = (strlen(shown_name) + 1) & 255;
+  buffer[9] = (strlen(shown_name) + 1) >> 8;
+  checksum = 1L;
+  checksum = update_adler32(checksum, buffer, 10);
+  checksum = update_adler32(checksum, shown_name, strlen(shown_name) + 1);
+  write_chunk_header(f, 1, 0, 10 + strlen(shown_name) + 1, checksum, 0);
+  fwrite(buffer, 10, 1, f);
+  fwrite(shown_name, strlen(shown_name) + 1, 1, f);
+
+  /* read file and place in archive */
+  for (;;) {
+    int compress_method = method;
+    size_t bytes_read = fread(buffer, 1, BLOCK_SIZE, in);
+    if (bytes_read == 0) break;
+
+    /* too small, don't bother to compress */
+    if (bytes_read < 32) compress_method = 0;
+
+    /* write to output */
+    switch (compress_method) {
+      /* FastLZ */
+      case 1:
+        chunk_size = fastlz_compress_level(level, buffer, bytes_read, result);
+        checksum = update_adler32(1L, result, chunk_size);
+        write_chunk_header(f, 17, 1, chunk_size, checksum, bytes_read);
+        fwrite(result, 1, chunk_size, f);
+        break;
+
+      /* uncompressed, also fallback method */
+      case 0:
+      default:
+        checksum = 1L;
+        checksum = update_adler32(checksum, buffer, bytes_read);
+        write_chunk_header(f, 17, 0, bytes_read, checksum, bytes_read);
+        fwrite(buffer, 1, bytes_read, f);
+        break;
+    }
+  }
+
+  fclose(in);
+  return 0;
+}
+
+static int pack(const char* output_file, int level, const char** input_files, int n) {
+  int i;
+  FILE* f = fopen(output_file, "wb");
+  if (!f) return -1;
+  write_magic(f);
+  for (i = 0; i < n; i++)
+    if (pack_file_compressed(input_files[i], 1, level, f) < 0) return -1;
+  fclose(f);
+  return 0;
+}
+
+int main(void) {
+  const char* hello[] = {"in/hello.txt"};
+  const char* seq[] = {"in/seq.txt"};
+  const char* multi[] = {"in/hello.txt", "in/seq.txt", "in/empty.txt", "in/lcg.bin"};
+
+  if (pack("hello.6pk", 2, hello, 1) < 0) return 1;
+  if (pack("seq.6pk", 2, seq, 1) < 0) return 1;
+  if (pack("seq-level1.6pk", 1, seq, 1) < 0) return 1;
+  if (pack("multi.6pk", 2, multi, 4) < 0) return 1;
+  return 0;
+}